@@ -0,0 +1,169 @@
+package httpstream
+
+import (
+	"net/http"
+)
+
+// Authenticator adds credentials to each request the client makes, ie an
+// Authorization header.  It is called on every connect and reconnect, so the
+// credentials may change between them.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// Refresher is an Authenticator that can get new credentials when the
+// server rejects a request with a 401, the request is retried once after
+// Refresh.
+type Refresher interface {
+	Authenticator
+	Refresh() error
+}
+
+// AuthenticatorFunc adapts a func to an Authenticator.
+type AuthenticatorFunc func(req *http.Request) error
+
+func (f AuthenticatorFunc) Authenticate(req *http.Request) error {
+	return f(req)
+}
+
+type basicAuth struct {
+	username, password string
+}
+
+// BasicAuth authenticates with http basic auth.  For flowdock use the
+// personal api token as the username, with an empty password.
+func BasicAuth(username, password string) Authenticator {
+	return basicAuth{username, password}
+}
+
+func (a basicAuth) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Basic "+encodedAuth(a.username, a.password))
+	return nil
+}
+
+type bearerAuth struct {
+	tokens TokenSource
+}
+
+// BearerAuth authenticates with OAuth 2.0 bearer tokens, see NewBearerClient.
+func BearerAuth(tokens TokenSource) Refresher {
+	return bearerAuth{tokens}
+}
+
+func (a bearerAuth) Authenticate(req *http.Request) error {
+	token, err := a.tokens.Token(false)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (a bearerAuth) Refresh() error {
+	Log(WARN, "bearer token rejected, refreshing")
+	_, err := a.tokens.Token(true)
+	return err
+}
+
+// HeaderAuth sets a header, ie an api key:
+//
+//	client.Auth = httpstream.HeaderAuth("X-Api-Key", key)
+func HeaderAuth(name, value string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.Header.Set(name, value)
+		return nil
+	})
+}
+
+// QueryAuth adds a token to the url query, ie flowdock's access_token.
+func QueryAuth(param, value string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		query := req.URL.Query()
+		query.Set(param, value)
+		req.URL.RawQuery = query.Encode()
+		return nil
+	})
+}
+
+type rotatingAuth struct {
+	provider func() (Authenticator, error)
+}
+
+// RotatingAuth asks provider for the credentials on every connect attempt,
+// so they can be rotated (by a secrets manager, say) between reconnects.
+// After a 401 the request is retried once, with whatever provider returns.
+func RotatingAuth(provider func() (Authenticator, error)) Refresher {
+	return rotatingAuth{provider}
+}
+
+func (a rotatingAuth) Authenticate(req *http.Request) error {
+	auth, err := a.provider()
+	if err != nil {
+		return err
+	}
+	return auth.Authenticate(req)
+}
+
+func (a rotatingAuth) Refresh() error {
+	return nil
+}
+
+// doAuthenticated sends the request built by newReq, authenticated by auth
+// (which may be nil).  If the credentials are rejected with a 401 and can be
+// refreshed, the request is built and sent once more.
+func doAuthenticated(client *http.Client, auth Authenticator, newReq func() (*http.Request, error)) (resp *http.Response, err error) {
+	for retried := false; ; retried = true {
+		var req *http.Request
+		if req, err = newReq(); err != nil {
+			return
+		}
+		if auth != nil {
+			if err = auth.Authenticate(req); err != nil {
+				Log(ERROR, "Could not authenticate: ", err)
+				return
+			}
+		}
+		Debug(req.Header)
+		if resp, err = client.Do(req); err != nil {
+			return
+		}
+		refresher, ok := auth.(Refresher)
+		if resp.StatusCode != http.StatusUnauthorized || !ok || retried {
+			return
+		}
+		resp.Body.Close()
+		if err = refresher.Refresh(); err != nil {
+			Log(ERROR, "Could not refresh credentials: ", err)
+			return nil, err
+		}
+	}
+}
+
+// authName describes the kind of auth for tracing
+func authName(auth Authenticator) string {
+	switch auth.(type) {
+	case nil:
+		return "none"
+	case basicAuth:
+		return "basic"
+	case oauth1:
+		return "oauth"
+	case bearerAuth:
+		return "bearer"
+	}
+	return "custom"
+}
+
+// authenticator returns the client's Auth, or one for the credentials given
+// to its constructor.
+func (c *Client) authenticator() Authenticator {
+	switch {
+	case c.Auth != nil:
+		return c.Auth
+	case c.Tokens != nil:
+		return BearerAuth(c.Tokens)
+	case c.Username != "" && c.Password != "":
+		return BasicAuth(c.Username, c.Password)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package httpstream
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/araddon/httpstream/httpstreamtest"
+)
+
+func TestAuthenticators(t *testing.T) {
+	for _, test := range []struct {
+		auth   Authenticator
+		header string
+		value  string
+	}{
+		{BasicAuth("user", "pwd"), "Authorization", "Basic dXNlcjpwd2Q="},
+		{BearerAuth(StaticToken("abc")), "Authorization", "Bearer abc"},
+		{HeaderAuth("X-Api-Key", "key"), "X-Api-Key", "key"},
+		{RotatingAuth(func() (Authenticator, error) { return HeaderAuth("X-Api-Key", "rotated"), nil }), "X-Api-Key", "rotated"},
+	} {
+		req, _ := http.NewRequest("GET", "https://stream.example.com/flows?filter=a", nil)
+		if err := test.auth.Authenticate(req); err != nil || req.Header.Get(test.header) != test.value {
+			t.Errorf("%s expected %q got %q %v", authName(test.auth), test.value, req.Header.Get(test.header), err)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "https://stream.flowdock.com/flows?filter=a", nil)
+	QueryAuth("access_token", "tok").Authenticate(req)
+	if q := req.URL.Query(); q.Get("access_token") != "tok" || q.Get("filter") != "a" {
+		t.Errorf("unexpected query %v", req.URL)
+	}
+}
+
+func TestRotatingAuth(t *testing.T) {
+	srv := httpstreamtest.NewServer(
+		httpstreamtest.Script{httpstreamtest.Status(401)},
+		httpstreamtest.Script{
+			httpstreamtest.Message(`{"id_str":"1","text":"one"}`),
+			httpstreamtest.Hold(),
+		},
+	)
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	secrets := []string{"old", "new"}
+	lines := make(chan []byte, 10)
+	client := NewClient(func(line []byte) {
+		lines <- line
+	})
+	client.Auth = RotatingAuth(func() (Authenticator, error) {
+		secret := secrets[0]
+		if len(secrets) > 1 {
+			secrets = secrets[1:]
+		}
+		return BasicAuth("user", secret), nil
+	})
+	if err := client.Connect(u, nil, make(chan bool, 1)); err != nil {
+		t.Fatal(err)
+	}
+	waitForLines(t, lines, 1)
+	client.Close()
+
+	reqs := srv.Requests()
+	if len(reqs) != 2 || reqs[0].Header.Get("Authorization") != "Basic "+encodedAuth("user", "old") ||
+		reqs[1].Header.Get("Authorization") != "Basic "+encodedAuth("user", "new") {
+		t.Errorf("expected the rotated secret after a 401 %v", reqs)
+	}
+}
@@ -0,0 +1,59 @@
+package httpstream
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// The max backfill twitter will deliver on elevated access streams, see
+// https://dev.twitter.com/docs/streaming-apis/parameters#count
+const MaxBackfill = 150000
+
+// ConnectInfo describes a connect attempt, and is passed to a ParamsFunc so
+// that params can be adjusted per (re)connect.
+type ConnectInfo struct {
+	// 0 for the initial connect, incremented on each reconnect attempt
+	Attempt int
+	// time since the last message was received, 0 on initial connect
+	Disconnected time.Duration
+	// messages per second seen on the previous connection
+	Rate float64
+}
+
+// ParamsFunc is called before every connect and reconnect with a copy of the
+// params passed to Connect, it returns the params to use for that attempt.
+type ParamsFunc func(params map[string]string, info ConnectInfo) map[string]string
+
+// BackfillParams returns a ParamsFunc that asks for count=N on reconnect,
+// where N is our estimate of the messages missed while disconnected (observed
+// rate * disconnected duration), capped at max.
+func BackfillParams(max int) ParamsFunc {
+	if max <= 0 || max > MaxBackfill {
+		max = MaxBackfill
+	}
+	return func(params map[string]string, info ConnectInfo) map[string]string {
+		if info.Attempt == 0 || info.Disconnected <= 0 {
+			return params
+		}
+		n := int(math.Ceil(info.Rate * info.Disconnected.Seconds()))
+		if n <= 0 {
+			return params
+		}
+		if n > max {
+			n = max
+		}
+		params["count"] = strconv.Itoa(n)
+		return params
+	}
+}
+
+// Backfill turns on automatic backfill for elevated access streams (see
+// BackfillParams) and drops replayed tweets that have already been handled.
+func (c *Client) Backfill(max int) {
+	if max <= 0 || max > MaxBackfill {
+		max = MaxBackfill
+	}
+	c.ParamsFunc = BackfillParams(max)
+	c.seen = NewDeduper(DedupeConfig{Size: max})
+}
@@ -0,0 +1,50 @@
+package httpstream
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestJSONLookup(t *testing.T) {
+	line := []byte(`{"retweeted_status":{"id_str":"1","user":{"id_str":"2"}}, "text":"a \"quoted\" {brace}","id_str":"3","user":{"id_str":"4"}}`)
+	if id := jsonString(line, "id_str"); id != "3" {
+		t.Errorf("expected top level id_str 3 got %q", id)
+	}
+	if id := jsonString(line, "user", "id_str"); id != "4" {
+		t.Errorf("expected user id_str 4 got %q", id)
+	}
+	if id := jsonString(line, "retweeted_status", "user", "id_str"); id != "2" {
+		t.Errorf("expected retweeted user id_str 2 got %q", id)
+	}
+	if val := jsonLookup(line, "nope"); val != nil {
+		t.Errorf("expected nil got %s", val)
+	}
+	if val := jsonLookup([]byte(`{"delete":{"status":{"id":5}}}`), "delete", "status", "id"); string(val) != "5" {
+		t.Errorf("expected 5 got %s", val)
+	}
+	for _, js := range tweets {
+		m := make(map[string]interface{})
+		json.Unmarshal([]byte(js), &m)
+		idStr, _ := m["id_str"].(string)
+		if id := jsonString([]byte(js), "id_str"); id != idStr {
+			t.Errorf("expected id_str %q got %q", idStr, id)
+		}
+	}
+}
+
+func TestBackfillParams(t *testing.T) {
+	pf := BackfillParams(1000)
+	p := pf(map[string]string{"track": "golang"}, ConnectInfo{Attempt: 0})
+	if _, ok := p["count"]; ok {
+		t.Error("should not backfill on initial connect")
+	}
+	p = pf(map[string]string{}, ConnectInfo{Attempt: 1, Disconnected: 10 * time.Second, Rate: 5})
+	if p["count"] != "50" {
+		t.Errorf("expected count=50 got %q", p["count"])
+	}
+	p = pf(map[string]string{}, ConnectInfo{Attempt: 1, Disconnected: time.Hour, Rate: 5})
+	if p["count"] != "1000" {
+		t.Errorf("expected count capped at 1000 got %q", p["count"])
+	}
+}
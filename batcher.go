@@ -0,0 +1,102 @@
+package httpstream
+
+import (
+	"sync"
+	"time"
+)
+
+// Batcher is a handler wrapper that collects messages and hands them to
+// flush in batches, when the batch reaches MaxMessages, MaxBytes, or the
+// oldest message in it has waited MaxLatency.  Zero values are no limit.
+//
+// Messages are copied as they are added, so the handler need not worry about
+// the stream reusing its buffers, and flush owns the batch it is given.
+// Flushes on the MaxLatency timer run on their own goroutine, where a panic
+// in flush is recovered and reported to ErrorHandler like the client's.
+//
+//	batcher := httpstream.NewBatcher(500, 1<<20, time.Second, writeRows)
+//	client := httpstream.NewBasicAuthClient(user, pwd, batcher.Handle)
+//	client.OnClose(batcher.Close)
+type Batcher struct {
+	MaxMessages int
+	MaxBytes    int
+	MaxLatency  time.Duration
+	// optional, called with the error (and a nil line) when flush panics on
+	// the MaxLatency timer
+	ErrorHandler func(err error, line []byte)
+	flush        func([][]byte)
+	// flushMu serializes calls to flush, so batches arrive in order
+	flushMu sync.Mutex
+	mu      sync.Mutex
+	batch   [][]byte
+	size    int
+	// incremented every flush, so a timer for an old batch is ignored
+	gen    int
+	timer  *time.Timer
+	closed bool
+}
+
+func NewBatcher(maxMessages, maxBytes int, maxLatency time.Duration, flush func([][]byte)) *Batcher {
+	return &Batcher{
+		MaxMessages: maxMessages,
+		MaxBytes:    maxBytes,
+		MaxLatency:  maxLatency,
+		flush:       flush,
+	}
+}
+
+// Handle adds a message to the batch, flushing if it is full.
+func (b *Batcher) Handle(line []byte) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		Log(ERROR, "batcher closed, dropping message")
+		return
+	}
+	b.batch = append(b.batch, append([]byte(nil), line...))
+	b.size += len(line)
+	full := (b.MaxMessages > 0 && len(b.batch) >= b.MaxMessages) || (b.MaxBytes > 0 && b.size >= b.MaxBytes)
+	if !full && len(b.batch) == 1 && b.MaxLatency > 0 {
+		gen := b.gen
+		b.timer = time.AfterFunc(b.MaxLatency, func() {
+			safeHandle(func([]byte) { b.flushGen(gen) }, nil, b.ErrorHandler)
+		})
+	}
+	b.mu.Unlock()
+	if full {
+		b.Flush()
+	}
+}
+
+// Flush hands the current batch, if any, to flush.
+func (b *Batcher) Flush() {
+	b.flushGen(-1)
+}
+
+// flush the batch, if gen is -1 or still the current batch
+func (b *Batcher) flushGen(gen int) {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+	b.mu.Lock()
+	if (gen >= 0 && gen != b.gen) || len(b.batch) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	batch := b.batch
+	b.batch, b.size = nil, 0
+	b.gen++
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mu.Unlock()
+	b.flush(batch)
+}
+
+// Close flushes whatever is left, after which messages are dropped.
+func (b *Batcher) Close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	b.Flush()
+}
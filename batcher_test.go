@@ -0,0 +1,88 @@
+package httpstream
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatcher(t *testing.T) {
+	var mu sync.Mutex
+	batches := make([][][]byte, 0)
+	b := NewBatcher(3, 10, 50*time.Millisecond, func(batch [][]byte) {
+		mu.Lock()
+		batches = append(batches, batch)
+		mu.Unlock()
+	})
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(batches)
+	}
+
+	line := []byte("a")
+	for i := 0; i < 3; i++ {
+		b.Handle(line)
+	}
+	if count() != 1 {
+		t.Fatalf("expected a batch after 3 messages got %d", count())
+	}
+	// the batcher keeps its own copies
+	line[0] = 'x'
+	if string(batches[0][0]) != "a" {
+		t.Errorf("expected batch to own its messages got %s", batches[0][0])
+	}
+
+	b.Handle([]byte(strings.Repeat("b", 12)))
+	if count() != 2 {
+		t.Fatalf("expected a batch after 10 bytes got %d", count())
+	}
+
+	b.Handle([]byte("c"))
+	time.Sleep(150 * time.Millisecond)
+	if count() != 3 || len(batches[2]) != 1 {
+		t.Fatalf("expected a batch after max latency got %d", count())
+	}
+
+	b.Handle([]byte("d"))
+	b.Close()
+	b.Handle([]byte("e"))
+	if count() != 4 || string(batches[3][0]) != "d" {
+		t.Errorf("expected final flush on close got %d", count())
+	}
+}
+
+func TestBatcherTimerPanic(t *testing.T) {
+	flushed := make(chan int, 10)
+	b := NewBatcher(0, 0, 10*time.Millisecond, func(batch [][]byte) {
+		if string(batch[0]) == "boom" {
+			panic("boom")
+		}
+		flushed <- len(batch)
+	})
+	errs := make(chan error, 10)
+	b.ErrorHandler = func(err error, line []byte) {
+		errs <- err
+	}
+	b.Handle([]byte("boom"))
+	select {
+	case err := <-errs:
+		if _, ok := err.(*HandlerPanic); !ok {
+			t.Errorf("expected a HandlerPanic got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the timer flush panic reported")
+	}
+	// and the batcher carries on
+	b.Handle([]byte("a"))
+	select {
+	case n := <-flushed:
+		if n != 1 {
+			t.Errorf("expected a batch of 1 got %d", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a flush after the panic")
+	}
+	b.Close()
+}
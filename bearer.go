@@ -0,0 +1,128 @@
+package httpstream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The token endpoint for twitter application only auth.
+// https://dev.twitter.com/docs/auth/application-only-auth
+const TwitterTokenURL = "https://api.twitter.com/oauth2/token"
+
+// TokenSource provides OAuth 2.0 bearer tokens.  Token is called before each
+// connect attempt, with refresh true when the last token was rejected with a
+// 401, in which case a new token should be fetched.
+type TokenSource interface {
+	Token(refresh bool) (string, error)
+}
+
+// StaticToken is a TokenSource for a fixed token, ie a personal access token.
+type StaticToken string
+
+func (t StaticToken) Token(refresh bool) (string, error) {
+	return string(t), nil
+}
+
+// ClientCredentials is a TokenSource that gets an app token from a token
+// endpoint using the OAuth 2.0 client credentials grant (RFC 6749 4.4), such
+// as twitter's application only auth.  The token is cached until it expires
+// or is rejected.
+type ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// optional, defaults to http.DefaultClient
+	HTTPClient *http.Client
+	mu         sync.Mutex
+	token      string
+	expiry     time.Time
+}
+
+// a token is refreshed this long before it expires
+const tokenExpiryDelta = 10 * time.Second
+
+func (cc *ClientCredentials) Token(refresh bool) (string, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.token != "" && !refresh && (cc.expiry.IsZero() || time.Now().Before(cc.expiry.Add(-tokenExpiryDelta))) {
+		return cc.token, nil
+	}
+	token, expiry, err := cc.fetch()
+	if err != nil {
+		return "", err
+	}
+	cc.token, cc.expiry = token, expiry
+	return token, nil
+}
+
+func (cc *ClientCredentials) fetch() (token string, expiry time.Time, err error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(cc.Scopes) > 0 {
+		form.Set("scope", strings.Join(cc.Scopes, " "))
+	}
+	req, err := http.NewRequest("POST", cc.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded;charset=UTF-8")
+	req.SetBasicAuth(url.QueryEscape(cc.ClientID), url.QueryEscape(cc.ClientSecret))
+	client := cc.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("token request failed: %s %s", resp.Status, body)
+		return
+	}
+	var tok struct {
+		TokenType   string `json:"token_type"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err = json.Unmarshal(body, &tok); err != nil {
+		return
+	}
+	if tok.AccessToken == "" || (tok.TokenType != "" && !strings.EqualFold(tok.TokenType, "bearer")) {
+		err = errors.New("token request failed: no bearer token in " + string(body))
+		return
+	}
+	if tok.ExpiresIn > 0 {
+		expiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	}
+	return tok.AccessToken, expiry, nil
+}
+
+// NewBearerClient creates a client authenticating with an OAuth 2.0 bearer
+// token, for a fixed token use StaticToken:
+//
+//	client := httpstream.NewBearerClient(httpstream.StaticToken(token), handler)
+//
+// or to get an app token:
+//
+//	client := httpstream.NewBearerClient(&httpstream.ClientCredentials{
+//		TokenURL: httpstream.TwitterTokenURL, ClientID: key, ClientSecret: secret}, handler)
+func NewBearerClient(tokens TokenSource, handler func([]byte)) *Client {
+	return &Client{
+		Tokens:    tokens,
+		Handler:   handler,
+		MaxWait:   300,
+		QueueSize: DefaultQueueSize,
+	}
+}
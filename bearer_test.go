@@ -0,0 +1,119 @@
+package httpstream
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/araddon/httpstream/httpstreamtest"
+)
+
+// a client credentials token endpoint, handing out t1, t2, ...
+type tokenServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	issued int
+}
+
+func newTokenServer(t *testing.T, expiresIn int) *tokenServer {
+	ts := &tokenServer{}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.FormValue("grant_type") != "client_credentials" {
+			t.Errorf("unexpected token request %v %v", r.Method, r.Form)
+		}
+		if id, secret, _ := r.BasicAuth(); id != "key" || secret != "sec%2Fret" {
+			http.Error(w, `{"errors":[{"code":99,"label":"authenticity_token_error","message":"Unable to verify your credentials"}]}`, 403)
+			return
+		}
+		ts.mu.Lock()
+		ts.issued++
+		n := ts.issued
+		ts.mu.Unlock()
+		fmt.Fprintf(w, `{"token_type":"bearer","access_token":"t%d","expires_in":%d}`, n, expiresIn)
+	}))
+	return ts
+}
+
+func TestClientCredentials(t *testing.T) {
+	ts := newTokenServer(t, 3600)
+	defer ts.Close()
+	cc := &ClientCredentials{TokenURL: ts.URL, ClientID: "key", ClientSecret: "sec/ret"}
+	for i, want := range []string{"t1", "t1", "t2"} {
+		token, err := cc.Token(i == 2)
+		if err != nil || token != want {
+			t.Errorf("%d expected %s got %s %v", i, want, token, err)
+		}
+	}
+
+	// tokens about to expire are refreshed
+	expiring := newTokenServer(t, 1)
+	defer expiring.Close()
+	cc = &ClientCredentials{TokenURL: expiring.URL, ClientID: "key", ClientSecret: "sec/ret"}
+	cc.Token(false)
+	if token, _ := cc.Token(false); token != "t2" {
+		t.Errorf("expected an expiring token to be refreshed got %s", token)
+	}
+
+	cc = &ClientCredentials{TokenURL: ts.URL, ClientID: "key", ClientSecret: "wrong"}
+	if _, err := cc.Token(false); err == nil {
+		t.Error("expected an error for bad credentials")
+	}
+}
+
+func TestBearerClient(t *testing.T) {
+	ts := newTokenServer(t, 0)
+	defer ts.Close()
+	srv := httpstreamtest.NewServer(
+		httpstreamtest.Script{httpstreamtest.Status(401)},
+		httpstreamtest.Script{
+			httpstreamtest.Message(`{"id_str":"1","text":"one"}`),
+			httpstreamtest.Drop(),
+		},
+		// the token has been revoked
+		httpstreamtest.Script{httpstreamtest.Status(401)},
+		httpstreamtest.Script{
+			httpstreamtest.Message(`{"id_str":"2","text":"two"}`),
+			httpstreamtest.Hold(),
+		},
+	)
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	lines := make(chan []byte, 10)
+	done := make(chan bool, 1)
+	client := NewBearerClient(&ClientCredentials{TokenURL: ts.URL, ClientID: "key", ClientSecret: "sec/ret"}, func(line []byte) {
+		lines <- line
+	})
+	if err := client.Connect(u, nil, done); err != nil {
+		t.Fatal(err)
+	}
+	waitForLines(t, lines, 2)
+	client.Close()
+
+	reqs := srv.Requests()
+	if len(reqs) != 4 {
+		t.Fatalf("expected 4 requests got %d", len(reqs))
+	}
+	for i, want := range []string{"Bearer t1", "Bearer t2", "Bearer t2", "Bearer t3"} {
+		if got := reqs[i].Header.Get("Authorization"); got != want {
+			t.Errorf("request %d expected %q got %q", i, want, got)
+		}
+	}
+}
+
+func TestStaticBearerToken(t *testing.T) {
+	srv := httpstreamtest.NewServer(httpstreamtest.Script{httpstreamtest.Status(401)}, httpstreamtest.Script{httpstreamtest.Status(401)})
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	client := NewBearerClient(StaticToken("abc"), func(line []byte) {})
+	if err := client.Connect(u, nil, make(chan bool, 1)); err == nil {
+		t.Error("expected an error once the token has been refused twice")
+	}
+	if reqs := srv.Requests(); len(reqs) != 2 || reqs[1].Header.Get("Authorization") != "Bearer abc" {
+		t.Errorf("unexpected requests %v", reqs)
+	}
+}
@@ -0,0 +1,223 @@
+package httpstream
+
+import (
+	"container/list"
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DedupeConfig configures a Deduper.
+type DedupeConfig struct {
+	// dotted json path of the message key, "id_str" if empty, ie "data.id"
+	// for twitter v2 messages.  Messages without the key pass through.
+	Key string
+	// how many keys to remember (with Bloom, per generation)
+	Size int
+	// optional, how long to remember keys (with Bloom, the max age of a
+	// generation)
+	TTL time.Duration
+	// remember keys in a pair of rotating bloom filters rather than an LRU,
+	// which uses a fraction of the memory, but will (rarely, see
+	// FalsePositive) drop messages that are not duplicates
+	Bloom bool
+	// bloom filter false positive rate, 0.0001 if 0
+	FalsePositive float64
+}
+
+// DedupeStats are the counters of a Deduper
+type DedupeStats struct {
+	// messages with a key
+	Seen int64
+	// of those, the duplicates that were dropped
+	Duplicates int64
+	// Duplicates / Seen
+	Rate float64
+}
+
+// Deduper detects messages it has recently seen, by id, using bounded memory.
+//
+//	dedupe := httpstream.NewDeduper(httpstream.DedupeConfig{Size: 100000, TTL: time.Hour})
+//	client.Use(dedupe.Middleware())
+type Deduper struct {
+	path []string
+	mu   sync.Mutex
+	keys keySet
+	seen int64
+	dups int64
+}
+
+// a bounded set of keys
+type keySet interface {
+	// Add the key, returning false if it was already present
+	Add(key string, now time.Time) bool
+}
+
+func NewDeduper(cfg DedupeConfig) *Deduper {
+	if cfg.Key == "" {
+		cfg.Key = "id_str"
+	}
+	if cfg.Size <= 0 {
+		cfg.Size = 10000
+	}
+	d := &Deduper{path: strings.Split(cfg.Key, ".")}
+	if cfg.Bloom {
+		if cfg.FalsePositive <= 0 || cfg.FalsePositive >= 1 {
+			cfg.FalsePositive = 0.0001
+		}
+		d.keys = newRotatingBloom(cfg.Size, cfg.FalsePositive, cfg.TTL)
+	} else {
+		d.keys = newLRUSet(cfg.Size, cfg.TTL)
+	}
+	return d
+}
+
+// Duplicate reports whether the message's key has been seen before, and
+// remembers it.
+func (d *Deduper) Duplicate(line []byte) bool {
+	key := jsonString(line, d.path...)
+	if key == "" {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.seen++
+	if d.keys.Add(key, time.Now()) {
+		return false
+	}
+	d.dups++
+	return true
+}
+
+// Middleware drops duplicate messages.
+func (d *Deduper) Middleware() Middleware {
+	return Filtering(func(line []byte) bool {
+		return !d.Duplicate(line)
+	})
+}
+
+func (d *Deduper) Stats() DedupeStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := DedupeStats{Seen: d.seen, Duplicates: d.dups}
+	if d.seen > 0 {
+		stats.Rate = float64(d.dups) / float64(d.seen)
+	}
+	return stats
+}
+
+// lruSet remembers the most recently seen size keys, for at most ttl
+type lruSet struct {
+	size  int
+	ttl   time.Duration
+	order *list.List
+	keys  map[string]*list.Element
+}
+
+type lruEntry struct {
+	key  string
+	seen time.Time
+}
+
+func newLRUSet(size int, ttl time.Duration) *lruSet {
+	return &lruSet{size: size, ttl: ttl, order: list.New(), keys: make(map[string]*list.Element, size)}
+}
+
+func (s *lruSet) Add(key string, now time.Time) bool {
+	s.expire(now)
+	if el, ok := s.keys[key]; ok {
+		el.Value.(*lruEntry).seen = now
+		s.order.MoveToFront(el)
+		return false
+	}
+	s.keys[key] = s.order.PushFront(&lruEntry{key, now})
+	for s.order.Len() > s.size {
+		s.remove(s.order.Back())
+	}
+	return true
+}
+
+func (s *lruSet) expire(now time.Time) {
+	if s.ttl <= 0 {
+		return
+	}
+	for el := s.order.Back(); el != nil && now.Sub(el.Value.(*lruEntry).seen) > s.ttl; el = s.order.Back() {
+		s.remove(el)
+	}
+}
+
+func (s *lruSet) remove(el *list.Element) {
+	s.order.Remove(el)
+	delete(s.keys, el.Value.(*lruEntry).key)
+}
+
+// rotatingBloom checks the current and previous bloom filters, and starts a
+// new generation when the current is full (or older than ttl), so keys are
+// remembered for between 1 and 2 generations.
+type rotatingBloom struct {
+	n        int
+	ttl      time.Duration
+	m        uint64
+	k        int
+	current  *bloom
+	previous *bloom
+}
+
+type bloom struct {
+	bits    []uint64
+	count   int
+	started time.Time
+}
+
+func newRotatingBloom(n int, fp float64, ttl time.Duration) *rotatingBloom {
+	m := uint64(math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2)))
+	k := int(math.Ceil(float64(m) / float64(n) * math.Ln2))
+	r := &rotatingBloom{n: n, ttl: ttl, m: m, k: k}
+	r.current = r.newBloom(time.Time{})
+	return r
+}
+
+func (r *rotatingBloom) newBloom(now time.Time) *bloom {
+	return &bloom{bits: make([]uint64, (r.m+63)/64), started: now}
+}
+
+func (r *rotatingBloom) Add(key string, now time.Time) bool {
+	if r.current.started.IsZero() {
+		r.current.started = now
+	}
+	if r.current.count >= r.n || (r.ttl > 0 && now.Sub(r.current.started) > r.ttl) {
+		r.previous, r.current = r.current, r.newBloom(now)
+	}
+	h1, h2 := bloomHashes(key)
+	if r.has(r.current, h1, h2) || (r.previous != nil && r.has(r.previous, h1, h2)) {
+		return false
+	}
+	for i := 0; i < r.k; i++ {
+		bit := (h1 + uint64(i)*h2) % r.m
+		r.current.bits[bit/64] |= 1 << (bit % 64)
+	}
+	r.current.count++
+	return true
+}
+
+func (r *rotatingBloom) has(b *bloom, h1, h2 uint64) bool {
+	for i := 0; i < r.k; i++ {
+		bit := (h1 + uint64(i)*h2) % r.m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// two hashes for double hashing, h1 + i*h2
+func bloomHashes(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+	h.Write([]byte{0})
+	h2 := h.Sum64() | 1
+	return h1, h2
+}
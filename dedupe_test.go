@@ -0,0 +1,62 @@
+package httpstream
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDeduper(t *testing.T) {
+	d := NewDeduper(DedupeConfig{Size: 2})
+	if d.Duplicate([]byte(`{"id_str":"1"}`)) || d.Duplicate([]byte(`{"id_str":"2"}`)) {
+		t.Error("first sighting is not a duplicate")
+	}
+	if !d.Duplicate([]byte(`{"id_str":"1"}`)) {
+		t.Error("expected duplicate")
+	}
+	// 1 was just seen again, so 2 is the least recently used
+	d.Duplicate([]byte(`{"id_str":"3"}`))
+	if d.Duplicate([]byte(`{"id_str":"2"}`)) {
+		t.Error("2 should have been evicted")
+	}
+	if d.Duplicate([]byte(`{"delete":{}}`)) {
+		t.Error("messages without ids are never duplicates")
+	}
+	if stats := d.Stats(); stats.Seen != 5 || stats.Duplicates != 1 || stats.Rate != 0.2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// configurable key, and ttl
+	lru := newLRUSet(10, time.Minute)
+	now := time.Now()
+	lru.Add("a", now)
+	if lru.Add("a", now.Add(30*time.Second)) || !lru.Add("a", now.Add(2*time.Minute)) {
+		t.Error("expected a to expire after the ttl")
+	}
+	d = NewDeduper(DedupeConfig{Key: "data.id"})
+	if d.Duplicate([]byte(`{"data":{"id":"1"}}`)) || !d.Duplicate([]byte(`{"data":{"id":"1"}}`)) {
+		t.Error("expected data.id to be the key")
+	}
+}
+
+func TestBloomDeduper(t *testing.T) {
+	d := NewDeduper(DedupeConfig{Size: 1000, Bloom: true, FalsePositive: 0.001})
+	for i := 0; i < 1000; i++ {
+		d.Duplicate([]byte(fmt.Sprintf(`{"id_str":"%d"}`, i)))
+	}
+	if stats := d.Stats(); stats.Duplicates > 5 {
+		t.Errorf("too many false positives %+v", stats)
+	}
+	for i := 0; i < 1000; i++ {
+		if !d.Duplicate([]byte(fmt.Sprintf(`{"id_str":"%d"}`, i))) {
+			t.Fatalf("expected %d to be a duplicate", i)
+		}
+	}
+	// rotating twice forgets the first generation
+	for i := 1000; i < 3100; i++ {
+		d.Duplicate([]byte(fmt.Sprintf(`{"id_str":"%d"}`, i)))
+	}
+	if d.Duplicate([]byte(`{"id_str":"1"}`)) {
+		t.Error("expected the first generation to have been forgotten")
+	}
+}
@@ -0,0 +1,186 @@
+package httpstream
+
+import (
+	"bytes"
+	"html"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// Tweet text arrives html escaped (&amp; &lt; &gt;) and the entity indices
+// are offsets in unicode codepoints into the unescaped text.  Not all data
+// agrees (older tweets were indexed in utf-16 units, so astral plane chars
+// such as emoji count twice, and some sources index the escaped text), so we
+// check each entity against the text at its indices and use whichever way of
+// counting lines up.
+
+var unescapeTweet = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">")
+
+// an entity positioned in the tweet text
+type textEntity struct {
+	start, end int
+	// the text we expect at start:end, ie "#golang", "@araddon", "http://t.co/x"
+	expect string
+	// the url to link to, and the text to show for it
+	href    string
+	display string
+	// for url entities, the expanded url, "" if it should be left alone
+	expanded string
+}
+
+// a tweet's text, sliceable by entity indices
+type indexedText interface {
+	Len() int
+	Slice(start, end int) string
+}
+
+type runeText []rune
+
+func (t runeText) Len() int                    { return len(t) }
+func (t runeText) Slice(start, end int) string { return string(t[start:end]) }
+
+type utf16Text []uint16
+
+func (t utf16Text) Len() int                    { return len(t) }
+func (t utf16Text) Slice(start, end int) string { return string(utf16.Decode(t[start:end])) }
+
+// indexed by the escaped text, but sliced unescaped
+type escapedText struct {
+	indexedText
+}
+
+func (t escapedText) Slice(start, end int) string {
+	return unescapeTweet.Replace(t.indexedText.Slice(start, end))
+}
+
+func (t *Tweet) textEntities() []textEntity {
+	ents := make([]textEntity, 0)
+	for _, h := range t.Entities.Hashtags {
+		if len(h.Indices) == 2 {
+			ents = append(ents, textEntity{start: h.Indices[0], end: h.Indices[1], expect: "#" + h.Text,
+				href: "https://twitter.com/search?q=" + url.QueryEscape("#"+h.Text)})
+		}
+	}
+	for _, m := range t.Entities.UserMentions {
+		if len(m.Indices) == 2 {
+			ents = append(ents, textEntity{start: m.Indices[0], end: m.Indices[1], expect: "@" + m.ScreenName,
+				href: "https://twitter.com/" + m.ScreenName})
+		}
+	}
+	for _, u := range t.Entities.URLs {
+		if len(u.Indices) == 2 {
+			ent := textEntity{start: u.Indices[0], end: u.Indices[1], expect: u.URL, href: u.URL, display: u.URL}
+			if expanded := u.GetExpandedURL(); expanded != "" {
+				ent.href, ent.expanded = expanded, expanded
+			}
+			if display := u.GetDisplayURL(); display != "" {
+				ent.display = display
+			}
+			ents = append(ents, ent)
+		}
+	}
+	for _, m := range t.Entities.Media {
+		if len(m.Indices) == 2 {
+			ent := textEntity{start: m.Indices[0], end: m.Indices[1], expect: m.URL, href: m.URL, display: m.URL}
+			if m.ExpandedURL != "" {
+				ent.href, ent.expanded = m.ExpandedURL, m.ExpandedURL
+			}
+			if m.DisplayURL != "" {
+				ent.display = m.DisplayURL
+			}
+			ents = append(ents, ent)
+		}
+	}
+	sort.Sort(byStart(ents))
+	return ents
+}
+
+type byStart []textEntity
+
+func (e byStart) Len() int           { return len(e) }
+func (e byStart) Less(i, j int) bool { return e[i].start < e[j].start }
+func (e byStart) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+
+// indexText works out how the entity indices count into the tweet text, and
+// returns the text and the entities that line up with it.
+func (t *Tweet) indexText() (indexedText, []textEntity) {
+	ents := t.textEntities()
+	unescaped := unescapeTweet.Replace(t.Text)
+	candidates := []indexedText{
+		runeText(unescaped),
+		utf16Text(utf16.Encode([]rune(unescaped))),
+		escapedText{runeText(t.Text)},
+		escapedText{utf16Text(utf16.Encode([]rune(t.Text)))},
+	}
+	var best indexedText
+	var bestEnts []textEntity
+	for _, text := range candidates {
+		valid := validEntities(text, ents)
+		if len(valid) == len(ents) {
+			return text, valid
+		}
+		if best == nil || len(valid) > len(bestEnts) {
+			best, bestEnts = text, valid
+		}
+	}
+	return best, bestEnts
+}
+
+// the entities whose indices match their text, without overlaps
+func validEntities(text indexedText, ents []textEntity) []textEntity {
+	valid := make([]textEntity, 0, len(ents))
+	last := 0
+	for _, e := range ents {
+		if e.start < last || e.start > e.end || e.end > text.Len() {
+			continue
+		}
+		if !strings.EqualFold(text.Slice(e.start, e.end), e.expect) {
+			// hashtags may use the fullwidth ＃
+			if !strings.HasPrefix(e.expect, "#") || text.Slice(e.start, e.end) != "＃"+e.expect[1:] {
+				continue
+			}
+		}
+		valid = append(valid, e)
+		last = e.end
+	}
+	return valid
+}
+
+// RenderHTML returns the tweet text as html, with hashtags, mentions and urls
+// linked and the urls shown as their display url.
+func (t *Tweet) RenderHTML() string {
+	text, ents := t.indexText()
+	var buf bytes.Buffer
+	pos := 0
+	for _, e := range ents {
+		buf.WriteString(html.EscapeString(text.Slice(pos, e.start)))
+		label := text.Slice(e.start, e.end)
+		if e.display != "" {
+			label = e.display
+		}
+		buf.WriteString(`<a href="` + html.EscapeString(e.href) + `">` + html.EscapeString(label) + `</a>`)
+		pos = e.end
+	}
+	buf.WriteString(html.EscapeString(text.Slice(pos, text.Len())))
+	return buf.String()
+}
+
+// ExpandURLs returns the tweet text unescaped, with the t.co links replaced by
+// their expanded url.
+func (t *Tweet) ExpandURLs() string {
+	text, ents := t.indexText()
+	var buf bytes.Buffer
+	pos := 0
+	for _, e := range ents {
+		if e.expanded == "" {
+			continue
+		}
+		buf.WriteString(text.Slice(pos, e.start))
+		buf.WriteString(e.expanded)
+		pos = e.end
+	}
+	buf.WriteString(text.Slice(pos, text.Len()))
+	return buf.String()
+}
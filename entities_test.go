@@ -0,0 +1,53 @@
+package httpstream
+
+import (
+	"testing"
+)
+
+func TestRenderEntities(t *testing.T) {
+	expanded := "http://golang.org/doc"
+	display := "golang.org/doc"
+	tw := Tweet{
+		Text: "\U0001F600 @araddon #golang &amp; http://t.co/abc \U0001F44D",
+		Entities: Entity{
+			Hashtags:     []Hashtag{{Text: "golang", Indices: []int{11, 18}}},
+			UserMentions: []Mention{{ScreenName: "araddon", Indices: []int{2, 10}}},
+			URLs:         []TwitterURL{{URL: "http://t.co/abc", ExpandedURL: &expanded, DisplayURL: &display, Indices: []int{21, 36}}},
+		},
+	}
+	expectHTML := "\U0001F600 " +
+		`<a href="https://twitter.com/araddon">@araddon</a> ` +
+		`<a href="https://twitter.com/search?q=%23golang">#golang</a> &amp; ` +
+		`<a href="http://golang.org/doc">golang.org/doc</a> ` + "\U0001F44D"
+	if out := tw.RenderHTML(); out != expectHTML {
+		t.Errorf("expected\n%s\ngot\n%s", expectHTML, out)
+	}
+	expectText := "\U0001F600 @araddon #golang & http://golang.org/doc \U0001F44D"
+	if out := tw.ExpandURLs(); out != expectText {
+		t.Errorf("expected %q got %q", expectText, out)
+	}
+
+	// the same tweet indexed in utf-16 units, where the emoji counts as 2
+	for _, ent := range [][]int{tw.Entities.Hashtags[0].Indices, tw.Entities.UserMentions[0].Indices, tw.Entities.URLs[0].Indices} {
+		ent[0]++
+		ent[1]++
+	}
+	if out := tw.ExpandURLs(); out != expectText {
+		t.Errorf("expected %q got %q", expectText, out)
+	}
+
+	// null expanded urls are left alone
+	tw.Entities.URLs[0].ExpandedURL = nil
+	if out := tw.ExpandURLs(); out != "\U0001F600 @araddon #golang & http://t.co/abc \U0001F44D" {
+		t.Errorf("unexpected %q", out)
+	}
+
+	for _, tw := range testTweets(t) {
+		if tw.Text == "" {
+			continue
+		}
+		if _, ents := tw.indexText(); len(ents) != len(tw.textEntities()) {
+			t.Errorf("entities did not line up with %q", tw.Text)
+		}
+	}
+}
@@ -29,7 +29,7 @@ func main() {
 	stream := make(chan []byte, 200)
 	done := make(chan bool)
 
-	flowURL, _ := url.Parse("https://" + *token + "@stream.flowdock.com/flows?filter=" + *flow)
+	flowURL, _ := url.Parse("https://stream.flowdock.com/flows?filter=" + *flow)
 
 	// set the logger and log level
 	SetLogger(log.New(os.Stdout, "", log.Ldate|log.Ltime|log.Lshortfile), *logLevel)
@@ -38,6 +38,8 @@ func main() {
 	client := NewClient(func(line []byte) {
 		stream <- line
 	})
+	// flowdock takes the personal api token as the basic auth username
+	client.Auth = BasicAuth(*token, "")
 	_ = client.Connect(flowURL, nil, done)
 
 	for {
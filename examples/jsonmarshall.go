@@ -38,7 +38,7 @@ func printPrettyBytes(line []byte) {
 
 // Since there are multiple types besides tweets sent in the http stream
 // determine which it is in order to serialize correctly
-func HandleLine(th int, line []byte) {
+func HandleLine(line []byte) {
 	switch {
 	case bytes.HasPrefix(line, []byte(`{"event":`)):
 		var event httpstream.Event
@@ -58,10 +58,6 @@ func HandleLine(th int, line []byte) {
 	}
 }
 
-type Msg struct {
-	Line []byte
-}
-
 func main() {
 
 	var err error
@@ -69,14 +65,13 @@ func main() {
 	// set the logger and log level
 	httpstream.SetLogger(log.New(os.Stdout, "", log.Ldate|log.Ltime|log.Lshortfile), *logLevel)
 
-	stream := make(chan []byte)
 	done := make(chan bool)
 
-	client := httpstream.NewBasicAuthClient(*user, *pwd, func(line []byte) {
-		stream <- line
-	})
+	// decode json on 2 workers, tweets from the same user are handled in order
+	pool := httpstream.NewWorkerPool(2, httpstream.UserIDKey, HandleLine)
+	client := httpstream.NewBasicAuthClient(*user, *pwd, pool.Handle)
+	client.OnClose(pool.Close)
 	//err := client.Track([]string{"bieber,iphone,mac,android,ios,lady gaga,dancing,sick,game,when,why,where,how,who"}, stream)
-	// this opens a go routine that is effectively thread 1
 	if len(*track) > 0 {
 		err = client.Filter(nil, strings.Split(*track, ","), nil, nil, true, done)
 	} else {
@@ -85,16 +80,6 @@ func main() {
 	if err != nil {
 		println(err.Error())
 	}
-	// 2nd thread
-	go func() {
-		for {
-			line := <-stream
-			HandleLine(1, line)
-		}
-	}()
-	// 3rd thread
-	for {
-		line := <-stream
-		HandleLine(2, line)
-	}
+	_ = <-done
+	client.Close()
 }
@@ -4,8 +4,7 @@ package main
 
 import (
 	"flag"
-	"github.com/attilaolah/httpstream"
-	"github.com/mrjones/oauth"
+	"github.com/araddon/httpstream"
 	"log"
 	"os"
 	"strconv"
@@ -14,7 +13,6 @@ import (
 
 var (
 	maxCt    = flag.Int("maxct", 10, "Max # of messages")
-	user     = flag.String("user", "", "twitter username")
 	ck       = flag.String("ck", "", "Consumer Key")
 	cs       = flag.String("cs", "", "Consumer Secret")
 	ot       = flag.String("ot", "", "Oauth Token")
@@ -34,28 +32,10 @@ func main() {
 	stream := make(chan []byte, 1000)
 	done := make(chan bool)
 
-	c := oauth.NewConsumer(
-		*ck,
-		*cs,
-		oauth.ServiceProvider{
-			RequestTokenUrl:   "http://twitter.com/oauth/request_token",
-			AuthorizeTokenUrl: "http://twitter.com/oauth/authorize",
-			AccessTokenUrl:    "http://twitter.com/oauth/access_token",
-		},
-	)
-
-	//at := goauthcon.GetAccessToken(rt.Token, pin)
-	at := oauth.AccessToken{ID: "",
-		Token:    *ot,
-		Secret:   *osec,
-		UserRef:  *user,
-		Verifier: "",
-		Service:  "twitter",
-	}
 	// the stream listener effectively operates in one "thread"/goroutine
 	// as the httpstream Client processes inside a go routine it opens
 	// That includes the handler func we pass in here
-	client := httpstream.NewOAuthClient(c, &at, httpstream.OnlyTweetsFilter(func(line []byte) {
+	client := httpstream.NewOAuthClient(*ck, *cs, *ot, *osec, httpstream.OnlyTweetsFilter(func(line []byte) {
 		stream <- line
 		// although you can do heavy lifting here, it means you are doing all
 		// your work in the same thread as the http streaming/listener
@@ -0,0 +1,231 @@
+package httpstream
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// Point is a longitude, latitude pair (note geojson order, lon first).
+type Point struct {
+	Lon float64
+	Lat float64
+}
+
+// Precision of a tweet's location
+type Precision int
+
+const (
+	// no location available
+	PrecisionNone Precision = iota
+	// the centroid of the place the tweet was tagged with
+	PrecisionPlace
+	// exact coordinates from the device
+	PrecisionExact
+)
+
+func (p Precision) String() string {
+	switch p {
+	case PrecisionExact:
+		return "exact"
+	case PrecisionPlace:
+		return "place"
+	}
+	return "none"
+}
+
+func (p Precision) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Precision) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "exact":
+		*p = PrecisionExact
+	case "place":
+		*p = PrecisionPlace
+	default:
+		*p = PrecisionNone
+	}
+	return nil
+}
+
+// Point returns the coordinates as a Point, ok is false if not a valid point.
+func (c *Coordinate) Point() (Point, bool) {
+	if c == nil || len(c.Coordinates) < 2 {
+		return Point{}, false
+	}
+	return Point{c.Coordinates[0], c.Coordinates[1]}, true
+}
+
+// GeoJSON geometry of this point
+func (p Point) GeoJSON() []byte {
+	b, _ := json.Marshal(p.geometry())
+	return b
+}
+
+func (p Point) geometry() map[string]interface{} {
+	return map[string]interface{}{"type": "Point", "coordinates": []float64{p.Lon, p.Lat}}
+}
+
+// PointInPolygon reports whether p is inside the ring of [lon, lat]
+// coordinates, using ray casting.  Points exactly on an edge may go either way.
+func PointInPolygon(p Point, ring [][]float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		if len(ring[i]) < 2 || len(ring[j]) < 2 {
+			return false
+		}
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > p.Lat) != (yj > p.Lat) && p.Lon < (xj-xi)*(p.Lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// the outer ring of the polygon, or nil
+func (b *BoundingBox) ring() [][]float64 {
+	if b == nil || len(b.Coordinates) == 0 {
+		return nil
+	}
+	for _, pt := range b.Coordinates[0] {
+		if len(pt) < 2 {
+			return nil
+		}
+	}
+	return b.Coordinates[0]
+}
+
+// Contains reports whether the point is inside (or on the edge of) the
+// bounding box polygon.
+func (b *BoundingBox) Contains(p Point) bool {
+	ring := b.ring()
+	if len(ring) == 0 {
+		return false
+	}
+	return PointInPolygon(p, ring) || onEdge(p, ring)
+}
+
+// onEdge reports whether p lies on any segment of the ring, so that points
+// on the border of a box (or degenerate single point boxes) are inside
+func onEdge(p Point, ring [][]float64) bool {
+	const epsilon = 1e-9
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		x1, y1, x2, y2 := ring[j][0], ring[j][1], ring[i][0], ring[i][1]
+		cross := (p.Lon-x1)*(y2-y1) - (p.Lat-y1)*(x2-x1)
+		if math.Abs(cross) > epsilon {
+			continue
+		}
+		if p.Lon >= math.Min(x1, x2)-epsilon && p.Lon <= math.Max(x1, x2)+epsilon &&
+			p.Lat >= math.Min(y1, y2)-epsilon && p.Lat <= math.Max(y1, y2)+epsilon {
+			return true
+		}
+	}
+	return false
+}
+
+// Bounds returns the south west and north east corners of the box.
+func (b *BoundingBox) Bounds() (sw, ne Point, ok bool) {
+	ring := b.ring()
+	if len(ring) == 0 {
+		return
+	}
+	sw = Point{ring[0][0], ring[0][1]}
+	ne = sw
+	for _, pt := range ring[1:] {
+		sw.Lon, sw.Lat = math.Min(sw.Lon, pt[0]), math.Min(sw.Lat, pt[1])
+		ne.Lon, ne.Lat = math.Max(ne.Lon, pt[0]), math.Max(ne.Lat, pt[1])
+	}
+	return sw, ne, true
+}
+
+// Intersects reports whether the box overlaps the rectangle sw, ne.
+func (b *BoundingBox) Intersects(sw, ne Point) bool {
+	bsw, bne, ok := b.Bounds()
+	return ok && bsw.Lon <= ne.Lon && bne.Lon >= sw.Lon && bsw.Lat <= ne.Lat && bne.Lat >= sw.Lat
+}
+
+// Centroid of the bounding box polygon.
+func (b *BoundingBox) Centroid() (Point, bool) {
+	ring := b.ring()
+	if len(ring) == 0 {
+		return Point{}, false
+	}
+	var area, cx, cy float64
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		cross := ring[j][0]*ring[i][1] - ring[i][0]*ring[j][1]
+		area += cross
+		cx += (ring[j][0] + ring[i][0]) * cross
+		cy += (ring[j][1] + ring[i][1]) * cross
+	}
+	if area == 0 {
+		// a point or a line (twitter sends points as 4 identical coordinates)
+		var p Point
+		for _, pt := range ring {
+			p.Lon += pt[0]
+			p.Lat += pt[1]
+		}
+		n := float64(len(ring))
+		return Point{p.Lon / n, p.Lat / n}, true
+	}
+	area *= 3
+	return Point{cx / area, cy / area}, true
+}
+
+// GeoJSON geometry of the bounding box polygon
+func (b *BoundingBox) GeoJSON() []byte {
+	out, _ := json.Marshal(b.geometry())
+	return out
+}
+
+func (b *BoundingBox) geometry() map[string]interface{} {
+	return map[string]interface{}{"type": "Polygon", "coordinates": b.Coordinates}
+}
+
+// Location returns the best available point for the tweet, the exact
+// coordinates if it has them, else the centroid of its place.
+func (t *Tweet) Location() (Point, Precision) {
+	if t == nil {
+		return Point{}, PrecisionNone
+	}
+	if p, ok := t.Coordinates.Point(); ok {
+		return p, PrecisionExact
+	}
+	if t.Place != nil {
+		if p, ok := t.Place.Bounding.Centroid(); ok {
+			return p, PrecisionPlace
+		}
+	}
+	return Point{}, PrecisionNone
+}
+
+// GeoJSON returns a geojson Feature for the tweet located at Location(),
+// or nil if it has no location.
+//
+//	{"type":"Feature","geometry":{"type":"Point","coordinates":[-88.04,41.98]},
+//		"properties":{"id":"...","precision":"exact","place":"Itasca, IL"}}
+func (t *Tweet) GeoJSON() []byte {
+	p, precision := t.Location()
+	if precision == PrecisionNone {
+		return nil
+	}
+	props := map[string]interface{}{
+		"id":        t.IDStr,
+		"text":      t.Text,
+		"precision": precision.String(),
+	}
+	if t.User != nil {
+		props["screen_name"] = t.User.ScreenName
+	}
+	if t.Place != nil {
+		props["place"] = t.Place.FullName
+		props["place_type"] = t.Place.PlaceType
+	}
+	out, _ := json.Marshal(map[string]interface{}{
+		"type":       "Feature",
+		"geometry":   p.geometry(),
+		"properties": props,
+	})
+	return out
+}
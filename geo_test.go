@@ -0,0 +1,54 @@
+package httpstream
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestGeo(t *testing.T) {
+	twlist := testTweets(t)
+	place := twlist[10]
+
+	p, precision := place.Location()
+	if precision != PrecisionExact || p.Lon != -88.0435311 || p.Lat != 41.986279 {
+		t.Errorf("expected exact location got %v %v", p, precision)
+	}
+	if !place.Place.Bounding.Contains(p) {
+		t.Error("expected coordinates inside the place")
+	}
+	if place.Place.Bounding.Contains(Point{-88.06, 41.98}) {
+		t.Error("expected point outside the place")
+	}
+	if !place.Place.Bounding.Contains(Point{-88.051360, 41.96}) {
+		t.Error("expected point on the edge to be inside")
+	}
+
+	place.Coordinates = nil
+	p, precision = place.Location()
+	if precision != PrecisionPlace || math.Abs(p.Lon+88.0182955) > 1e-6 || math.Abs(p.Lat-41.9740285) > 1e-6 {
+		t.Errorf("expected place centroid got %v %v", p, precision)
+	}
+
+	feature := make(map[string]interface{})
+	if err := json.Unmarshal(place.GeoJSON(), &feature); err != nil {
+		t.Fatal(err)
+	}
+	props, _ := feature["properties"].(map[string]interface{})
+	if feature["type"] != "Feature" || props["precision"] != "place" || props["place"] != "Itasca, IL" {
+		t.Errorf("unexpected geojson %v", feature)
+	}
+
+	if _, precision = twlist[0].Location(); precision != PrecisionNone || twlist[0].GeoJSON() != nil {
+		t.Error("expected no location")
+	}
+	var nilTweet *Tweet
+	if _, precision = nilTweet.Location(); precision != PrecisionNone || nilTweet.GeoJSON() != nil {
+		t.Error("expected no location for a nil tweet")
+	}
+
+	triangle := [][]float64{{0, 0}, {10, 0}, {0, 10}}
+	if !PointInPolygon(Point{2, 2}, triangle) || PointInPolygon(Point{6, 6}, triangle) {
+		t.Error("point in polygon failed")
+	}
+}
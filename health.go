@@ -0,0 +1,142 @@
+package httpstream
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ConnState is the state of a Client's stream connection.
+type ConnState int
+
+const (
+	// not connected yet, or gave up reconnecting
+	StateDisconnected ConnState = iota
+	StateConnecting
+	StateConnected
+	// lost the connection, and trying to get it back
+	StateReconnecting
+	StateClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	}
+	return "disconnected"
+}
+
+func (s ConnState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Health is a snapshot of the state of a Client's stream.
+type Health struct {
+	State ConnState
+	URL   string
+	// when the current connection was made, zero if not connected
+	ConnectedAt time.Time
+	LastMessage time.Time
+	// consecutive failed connect attempts, and the last error
+	Failures int
+	Error    string `json:",omitempty"`
+}
+
+// healthState is updated by the stream reader, and read by Health.
+type healthState struct {
+	mu sync.Mutex
+	h  Health
+}
+
+func (s *healthState) update(f func(h *Health)) {
+	s.mu.Lock()
+	f(&s.h)
+	s.mu.Unlock()
+}
+
+func (s *healthState) failed(err error) {
+	s.update(func(h *Health) {
+		h.Failures++
+		h.Error = err.Error()
+	})
+}
+
+// Health returns the current state of the client's stream.
+func (c *Client) Health() Health {
+	c.health.mu.Lock()
+	defer c.health.mu.Unlock()
+	return c.health.h
+}
+
+// HealthConfig sets what HealthHandler considers healthy.  For a readiness
+// probe check the stream is connected and flowing:
+//
+//	http.Handle("/ready", client.HealthHandler(httpstream.HealthConfig{MaxSilence: 2 * time.Minute}))
+//
+// and for liveness that it hasn't given up, or failed too many times:
+//
+//	http.Handle("/live", client.HealthHandler(httpstream.HealthConfig{AllowReconnecting: true, MaxFailures: 10}))
+type HealthConfig struct {
+	// unhealthy if connected with no messages for this long, 0 to not check.
+	// Set it above the quiet periods of the stream, keep alives don't count.
+	MaxSilence time.Duration
+	// unhealthy after this many consecutive failed connect attempts, 0 to
+	// not check
+	MaxFailures int
+	// whether connecting and reconnecting count as healthy
+	AllowReconnecting bool
+}
+
+// Healthy checks h against the config, returning why if it isn't healthy.
+func (cfg HealthConfig) Healthy(h Health) (ok bool, reason string) {
+	switch h.State {
+	case StateConnected:
+	case StateConnecting, StateReconnecting:
+		if !cfg.AllowReconnecting {
+			return false, h.State.String()
+		}
+	default:
+		return false, h.State.String()
+	}
+	if cfg.MaxFailures > 0 && h.Failures >= cfg.MaxFailures {
+		return false, "too many connect failures"
+	}
+	if cfg.MaxSilence > 0 && h.State == StateConnected {
+		last := h.LastMessage
+		if h.ConnectedAt.After(last) {
+			last = h.ConnectedAt
+		}
+		if time.Since(last) > cfg.MaxSilence {
+			return false, "no messages since " + last.Format(time.RFC3339)
+		}
+	}
+	return true, ""
+}
+
+// HealthHandler serves the client's Health as json, with a 200 status if
+// healthy according to cfg, else 503.
+func (c *Client) HealthHandler(cfg HealthConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := c.Health()
+		ok, reason := cfg.Healthy(h)
+		status := http.StatusOK
+		if !ok {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(struct {
+			Health
+			Healthy bool
+			Reason  string `json:",omitempty"`
+		}{h, ok, reason})
+	})
+}
@@ -0,0 +1,145 @@
+package httpstream
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/araddon/httpstream/httpstreamtest"
+)
+
+func TestHealthy(t *testing.T) {
+	now := time.Now()
+	connected := Health{State: StateConnected, ConnectedAt: now.Add(-time.Hour), LastMessage: now.Add(-time.Second)}
+	quiet := Health{State: StateConnected, ConnectedAt: now.Add(-time.Hour), LastMessage: now.Add(-10 * time.Minute)}
+	reconnecting := Health{State: StateReconnecting, Failures: 3}
+	ready := HealthConfig{MaxSilence: time.Minute}
+	live := HealthConfig{AllowReconnecting: true, MaxFailures: 5}
+	for i, test := range []struct {
+		cfg  HealthConfig
+		h    Health
+		want bool
+	}{
+		{ready, connected, true},
+		{ready, quiet, false},
+		{ready, reconnecting, false},
+		{ready, Health{State: StateConnected, ConnectedAt: now}, true},
+		{ready, Health{}, false},
+		{live, quiet, true},
+		{live, reconnecting, true},
+		{live, Health{State: StateReconnecting, Failures: 5}, false},
+		{live, Health{State: StateClosed}, false},
+	} {
+		if ok, reason := test.cfg.Healthy(test.h); ok != test.want || ok != (reason == "") {
+			t.Errorf("%d expected %v got %v %q", i, test.want, ok, reason)
+		}
+	}
+}
+
+func TestClientHealth(t *testing.T) {
+	srv := httpstreamtest.NewServer(
+		httpstreamtest.Script{
+			httpstreamtest.Message(`{"id_str":"1","text":"one"}`),
+			httpstreamtest.Pause(50 * time.Millisecond),
+			httpstreamtest.Drop(),
+		},
+		// then 503s
+	)
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	lines := make(chan []byte, 10)
+	done := make(chan bool, 1)
+	client := NewBasicAuthClient("user", "pwd", func(line []byte) {
+		lines <- line
+	})
+	if h := client.Health(); h.State != StateDisconnected {
+		t.Errorf("expected disconnected before connect got %v", h.State)
+	}
+	if err := client.Connect(u, nil, done); err != nil {
+		t.Fatal(err)
+	}
+	waitForLines(t, lines, 1)
+
+	h := client.Health()
+	if h.State != StateConnected || h.URL != u.String() || h.LastMessage.IsZero() || h.ConnectedAt.IsZero() {
+		t.Errorf("unexpected health %+v", h)
+	}
+	w := httptest.NewRecorder()
+	client.HealthHandler(HealthConfig{MaxSilence: time.Minute}).ServeHTTP(w, httptest.NewRequest("GET", "/ready", nil))
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != 200 || body["State"] != "connected" || body["Healthy"] != true {
+		t.Errorf("expected healthy got %d %s", w.Code, w.Body)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for h = client.Health(); h.Failures < 2 && time.Now().Before(deadline); h = client.Health() {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if h.State != StateReconnecting || h.Failures < 2 || !strings.Contains(h.Error, "503") {
+		t.Errorf("expected failing reconnects %+v", h)
+	}
+	w = httptest.NewRecorder()
+	client.HealthHandler(HealthConfig{MaxSilence: time.Minute}).ServeHTTP(w, httptest.NewRequest("GET", "/ready", nil))
+	if w.Code != 503 {
+		t.Errorf("expected not ready got %d %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	client.HealthHandler(HealthConfig{AllowReconnecting: true, MaxFailures: 100}).ServeHTTP(w, httptest.NewRequest("GET", "/live", nil))
+	if w.Code != 200 {
+		t.Errorf("expected live got %d %s", w.Code, w.Body)
+	}
+
+	client.Close()
+	if h := client.Health(); h.State != StateClosed {
+		t.Errorf("expected closed got %v", h.State)
+	}
+}
+
+func TestClientHealthUnauthorized(t *testing.T) {
+	srv := httpstreamtest.NewServer(httpstreamtest.Script{httpstreamtest.Status(401)})
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	client := NewBasicAuthClient("user", "wrong", func(line []byte) {})
+	client.Connect(u, nil, make(chan bool, 1))
+	if h := client.Health(); h.State != StateDisconnected || h.Failures != 1 || !strings.Contains(h.Error, "401") {
+		t.Errorf("unexpected health %+v", h)
+	}
+}
+
+func TestClientHealthReconnect(t *testing.T) {
+	srv := httpstreamtest.NewServer(
+		httpstreamtest.Script{httpstreamtest.Message(`{"id_str":"1","text":"one"}`), httpstreamtest.Hold()},
+		httpstreamtest.Script{httpstreamtest.Message(`{"id_str":"2","text":"two"}`), httpstreamtest.Hold()},
+	)
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	lines := make(chan []byte, 10)
+	client := NewBasicAuthClient("user", "pwd", func(line []byte) {
+		lines <- line
+	})
+	if err := client.Connect(u, nil, make(chan bool, 1)); err != nil {
+		t.Fatal(err)
+	}
+	waitForLines(t, lines, 1)
+	// the first connection's reader closes it again once it notices it
+	// was replaced, which mustn't mark the client closed
+	if err := client.Connect(u, nil, make(chan bool, 1)); err != nil {
+		t.Fatal(err)
+	}
+	waitForLines(t, lines, 1)
+	time.Sleep(200 * time.Millisecond)
+	if h := client.Health(); h.State != StateConnected || h.ConnectedAt.IsZero() {
+		t.Errorf("expected connected after a second Connect got %+v", h)
+	}
+	client.Close()
+	if h := client.Health(); h.State != StateClosed {
+		t.Errorf("expected closed got %v", h.State)
+	}
+}
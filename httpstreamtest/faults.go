@@ -0,0 +1,175 @@
+package httpstreamtest
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Faults is the network trouble to inject into one connection.  Byte counts
+// are of the plaintext read from the connection, response headers included.
+type Faults struct {
+	// wait before each read
+	Latency time.Duration
+	// the most bytes a single read returns, so lines (and chunks) arrive
+	// split across reads, 0 for no limit
+	MaxRead int
+	// end the connection (as a clean EOF, mid chunk) after this many bytes
+	TruncateAfter int64
+	// reset the connection after this many bytes
+	ResetAfter int64
+	// fail the TLS handshake, or for plain http fail the dial
+	FailHandshake bool
+}
+
+// FaultTransport is an http.RoundTripper whose connections misbehave on a
+// schedule: the nth connection it dials gets the nth Faults, and any after
+// that get Default.  Keep alives are off, so each stream (and reconnect) is a
+// new connection.
+//
+//	ft := httpstreamtest.NewFaultTransport(
+//		httpstreamtest.Faults{MaxRead: 7, ResetAfter: 1000},
+//		httpstreamtest.Faults{FailHandshake: true},
+//	)
+//	client.Transport = ft
+type FaultTransport struct {
+	*http.Transport
+	// faults for connections past the end of the schedule
+	Default  Faults
+	mu       sync.Mutex
+	schedule []Faults
+	dials    int
+}
+
+func NewFaultTransport(schedule ...Faults) *FaultTransport {
+	ft := &FaultTransport{schedule: schedule}
+	ft.Transport = &http.Transport{
+		DisableKeepAlives: true,
+		DialContext:       ft.dial,
+		DialTLSContext:    ft.dialTLS,
+	}
+	return ft
+}
+
+// ForServer sets the TLS config to trust the server's certificate, for use
+// with StartTLS.
+func (ft *FaultTransport) ForServer(s *Server) *FaultTransport {
+	if t, ok := s.Client().Transport.(*http.Transport); ok && t.TLSClientConfig != nil {
+		ft.TLSClientConfig = t.TLSClientConfig.Clone()
+	}
+	return ft
+}
+
+// Dials returns the number of connections made so far.
+func (ft *FaultTransport) Dials() int {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	return ft.dials
+}
+
+func (ft *FaultTransport) next() Faults {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	n := ft.dials
+	ft.dials++
+	if n < len(ft.schedule) {
+		return ft.schedule[n]
+	}
+	return ft.Default
+}
+
+func (ft *FaultTransport) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	faults := ft.next()
+	if faults.FailHandshake {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: syscall.ECONNREFUSED}
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewFaultConn(conn, faults), nil
+}
+
+func (ft *FaultTransport) dialTLS(ctx context.Context, network, addr string) (net.Conn, error) {
+	faults := ft.next()
+	raw, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if faults.FailHandshake {
+		// the server hello is replaced with something that isn't tls
+		raw = &garbledConn{Conn: raw}
+	}
+	config := &tls.Config{}
+	if ft.TLSClientConfig != nil {
+		config = ft.TLSClientConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	conn := tls.Client(raw, config)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	return NewFaultConn(conn, faults), nil
+}
+
+// FaultConn is a net.Conn that injects Faults into what is read from it.
+type FaultConn struct {
+	net.Conn
+	faults Faults
+	read   int64
+}
+
+func NewFaultConn(conn net.Conn, faults Faults) *FaultConn {
+	return &FaultConn{Conn: conn, faults: faults}
+}
+
+func (c *FaultConn) Read(p []byte) (int, error) {
+	if c.faults.Latency > 0 {
+		time.Sleep(c.faults.Latency)
+	}
+	if c.faults.MaxRead > 0 && len(p) > c.faults.MaxRead {
+		p = p[:c.faults.MaxRead]
+	}
+	limit, err := int64(-1), error(nil)
+	if c.faults.TruncateAfter > 0 {
+		limit, err = c.faults.TruncateAfter, io.EOF
+	}
+	if c.faults.ResetAfter > 0 && (limit < 0 || c.faults.ResetAfter < limit) {
+		limit, err = c.faults.ResetAfter, &net.OpError{Op: "read", Net: "tcp", Addr: c.RemoteAddr(), Err: syscall.ECONNRESET}
+	}
+	if limit >= 0 {
+		if c.read >= limit {
+			c.Conn.Close()
+			return 0, err
+		}
+		if remaining := limit - c.read; int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+	n, rerr := c.Conn.Read(p)
+	c.read += int64(n)
+	return n, rerr
+}
+
+// garbledConn replaces what is read with an http response, which fails the
+// tls handshake with "first record does not look like a TLS handshake".
+type garbledConn struct {
+	net.Conn
+	sent bool
+}
+
+func (c *garbledConn) Read(p []byte) (int, error) {
+	if c.sent {
+		return 0, io.EOF
+	}
+	c.sent = true
+	return copy(p, "HTTP/1.0 400 Bad Request\r\n\r\n"), nil
+}
@@ -0,0 +1,157 @@
+package httpstreamtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RulesPath is where the twitter v2 filtered stream rules are managed.
+const RulesPath = "/2/tweets/search/stream/rules"
+
+// Rule is a v2 filtered stream rule.
+type Rule struct {
+	ID    string `json:"id"`
+	Value string `json:"value"`
+	Tag   string `json:"tag,omitempty"`
+}
+
+// Rules emulates the twitter v2 filtered stream rules endpoint, keeping the
+// rules in memory:
+//
+//	srv := httpstreamtest.NewServer(...)
+//	rules := &httpstreamtest.Rules{Token: "t1"}
+//	srv.Handle(httpstreamtest.RulesPath, rules)
+type Rules struct {
+	// if set, requests must have this bearer token
+	Token  string
+	mu     sync.Mutex
+	rules  []Rule
+	nextID int
+}
+
+// List returns the current rules.
+func (rs *Rules) List() []Rule {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return append([]Rule(nil), rs.rules...)
+}
+
+type ruleError struct {
+	Title string `json:"title"`
+	Type  string `json:"type"`
+	Value string `json:"value,omitempty"`
+	ID    string `json:"id,omitempty"`
+}
+
+func (rs *Rules) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if rs.Token != "" && r.Header.Get("Authorization") != "Bearer "+rs.Token {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"title": "Unauthorized", "type": "about:blank", "status": 401, "detail": "Unauthorized"})
+		return
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	meta := map[string]interface{}{"sent": time.Now().UTC().Format(time.RFC3339Nano)}
+	resp := map[string]interface{}{"meta": meta}
+
+	switch r.Method {
+	case "GET":
+		rules := rs.rules
+		if ids := r.URL.Query().Get("ids"); ids != "" {
+			rules = nil
+			for _, id := range strings.Split(ids, ",") {
+				if i := rs.index(id); i >= 0 {
+					rules = append(rules, rs.rules[i])
+				}
+			}
+		}
+		if len(rules) > 0 {
+			resp["data"] = rules
+		}
+		meta["result_count"] = len(rules)
+	case "POST":
+		var req struct {
+			Add    []Rule `json:"add"`
+			Delete *struct {
+				IDs []string `json:"ids"`
+			} `json:"delete"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Add == nil) == (req.Delete == nil) {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"title": "Invalid Request", "type": "https://api.twitter.com/2/problems/invalid-request",
+				"detail": "One or more parameters to your request was invalid."})
+			return
+		}
+		dryRun := r.URL.Query().Get("dry_run") == "true"
+		var errs []ruleError
+		if req.Add != nil {
+			var created []Rule
+			for _, rule := range req.Add {
+				if dup := rs.find(rule.Value); dup >= 0 {
+					errs = append(errs, ruleError{"DuplicateRule", "https://api.twitter.com/2/problems/duplicate-rules", rule.Value, rs.rules[dup].ID})
+					continue
+				}
+				rs.nextID++
+				rule.ID = strconv.Itoa(rs.nextID)
+				created = append(created, rule)
+			}
+			if !dryRun {
+				rs.rules = append(rs.rules, created...)
+			}
+			if len(created) > 0 {
+				resp["data"] = created
+			}
+			meta["summary"] = map[string]int{"created": len(created), "not_created": len(errs),
+				"valid": len(created), "invalid": len(errs)}
+		} else {
+			deleted := 0
+			for _, id := range req.Delete.IDs {
+				i := rs.index(id)
+				if i < 0 {
+					errs = append(errs, ruleError{"Not Found", "https://api.twitter.com/2/problems/resource-not-found", "", id})
+					continue
+				}
+				deleted++
+				if !dryRun {
+					rs.rules = append(rs.rules[:i], rs.rules[i+1:]...)
+				}
+			}
+			meta["summary"] = map[string]int{"deleted": deleted, "not_deleted": len(errs)}
+		}
+		if len(errs) > 0 {
+			resp["errors"] = errs
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (rs *Rules) index(id string) int {
+	for i, rule := range rs.rules {
+		if rule.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (rs *Rules) find(value string) int {
+	for i, rule := range rs.rules {
+		if rule.Value == value {
+			return i
+		}
+	}
+	return -1
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,309 @@
+// Package httpstreamtest provides a local streaming server for testing
+// httpstream clients, emulating the Twitter and Flowdock streaming apis.
+//
+// Each connection to the server plays the next Script of Steps:
+//
+//	srv := httpstreamtest.NewServer(
+//		httpstreamtest.Script{httpstreamtest.Status(401)},
+//		httpstreamtest.Script{httpstreamtest.Message(`{"text":"hi"}`), httpstreamtest.KeepAlive(), httpstreamtest.Drop()},
+//		httpstreamtest.Script{httpstreamtest.Message(`{"text":"back"}`), httpstreamtest.Hold()},
+//	)
+//	defer srv.Close()
+//	u, _ := url.Parse(srv.URL)
+//	client.Connect(u, params, done)
+package httpstreamtest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Step is one action of a Script, it returns false to end the response.
+type Step func(s *Stream) bool
+
+// Script is what the server does for one connection
+type Script []Step
+
+// Stream is the response being written to a client connection.
+type Stream struct {
+	w       http.ResponseWriter
+	r       *http.Request
+	quit    chan bool
+	started bool
+}
+
+// Write raw data to the client and flush it, returning false if the client
+// has gone away.
+func (s *Stream) Write(data string) bool {
+	s.start(http.StatusOK)
+	if _, err := s.w.Write([]byte(data)); err != nil {
+		return false
+	}
+	s.w.(http.Flusher).Flush()
+	return true
+}
+
+func (s *Stream) start(code int) {
+	if !s.started {
+		s.started = true
+		s.w.Header().Set("Content-Type", "application/json")
+		s.w.WriteHeader(code)
+	}
+}
+
+// Request records what the server received for a connection.
+type Request struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	Body   string
+	// the query and (for POST) form params
+	Form url.Values
+}
+
+// Server is a streaming http server that plays a Script per connection, once
+// they have all been played, connections get a 503.
+type Server struct {
+	*httptest.Server
+	mu       sync.Mutex
+	scripts  []Script
+	requests []Request
+	quit     chan bool
+	closed   bool
+	handlers map[string]http.Handler
+}
+
+func NewServer(scripts ...Script) *Server {
+	s := &Server{scripts: scripts, quit: make(chan bool)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// NewUnstartedServer returns a server that is not yet listening, so its
+// Config or TLS can be adjusted before calling Start or StartTLS.
+func NewUnstartedServer(scripts ...Script) *Server {
+	s := &Server{scripts: scripts, quit: make(chan bool)}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// AddScript queues another script, for the next connection to play.
+func (s *Server) AddScript(script Script) {
+	s.mu.Lock()
+	s.scripts = append(s.scripts, script)
+	s.mu.Unlock()
+}
+
+// Handle serves requests for path with h, ie a Rules endpoint, rather than
+// playing a script.  They aren't included in Requests.
+func (s *Server) Handle(path string, h http.Handler) {
+	s.mu.Lock()
+	if s.handlers == nil {
+		s.handlers = make(map[string]http.Handler)
+	}
+	s.handlers[path] = h
+	s.mu.Unlock()
+}
+
+// Requests returns the requests the server has received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// WaitForRequests waits up to timeout for the server to have received n
+// requests, returning those it has.
+func (s *Server) WaitForRequests(n int, timeout time.Duration) []Request {
+	deadline := time.Now().Add(timeout)
+	for {
+		reqs := s.Requests()
+		if len(reqs) >= n || time.Now().After(deadline) {
+			return reqs
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Close ends any held connections, and shuts down the server.
+func (s *Server) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.quit)
+	}
+	s.mu.Unlock()
+	s.Server.Close()
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	h := s.handlers[r.URL.Path]
+	s.mu.Unlock()
+	if h != nil {
+		h.ServeHTTP(w, r)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	req := Request{Method: r.Method, URL: r.URL, Header: r.Header, Body: string(body)}
+	req.Form, _ = url.ParseQuery(r.URL.RawQuery)
+	if r.Method == "POST" {
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			for k, v := range form {
+				req.Form[k] = append(req.Form[k], v...)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	n := len(s.requests)
+	s.requests = append(s.requests, req)
+	var script Script
+	if n < len(s.scripts) {
+		script = s.scripts[n]
+	}
+	s.mu.Unlock()
+
+	if script == nil {
+		http.Error(w, "no script for connection", http.StatusServiceUnavailable)
+		return
+	}
+	stream := &Stream{w: w, r: r, quit: s.quit}
+	for _, step := range script {
+		if !step(stream) {
+			return
+		}
+	}
+	stream.start(http.StatusOK)
+}
+
+// Message sends a line.
+func Message(line string) Step {
+	return func(s *Stream) bool {
+		return s.Write(line + "\r\n")
+	}
+}
+
+// Messages sends each of the lines.
+func Messages(lines ...string) Step {
+	return func(s *Stream) bool {
+		for _, line := range lines {
+			if !s.Write(line + "\r\n") {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// KeepAlive sends the blank line twitter sends every 30 seconds.
+func KeepAlive() Step {
+	return func(s *Stream) bool {
+		return s.Write("\r\n")
+	}
+}
+
+// StallWarning sends a twitter FALLING_BEHIND warning.
+func StallWarning(percentFull int) Step {
+	return Message(fmt.Sprintf(`{"warning":{"code":"FALLING_BEHIND","message":"Your connection is falling behind and messages are being queued for delivery to you. Your queue is now over %d%% full. You will be disconnected when the queue is full.","percent_full":%d}}`, percentFull, percentFull))
+}
+
+// Disconnect sends a twitter disconnect notice, and ends the response.
+// https://dev.twitter.com/docs/streaming-apis/messages#Disconnect_messages_disconnect
+func Disconnect(code int, reason string) Step {
+	return func(s *Stream) bool {
+		s.Write(fmt.Sprintf(`{"disconnect":{"code":%d,"stream_name":"httpstreamtest","reason":%q}}`, code, reason) + "\r\n")
+		return false
+	}
+}
+
+// Status responds with an http error status, such as 401 Unauthorized or 420
+// Enhance Your Calm, and ends the response.  It must be the first step.
+func Status(code int) Step {
+	return func(s *Stream) bool {
+		s.start(code)
+		s.w.Write([]byte(fmt.Sprintf("%d %s\n", code, http.StatusText(code))))
+		return false
+	}
+}
+
+// Header sets a response header, it must come before anything is written.
+func Header(key, value string) Step {
+	return func(s *Stream) bool {
+		s.w.Header().Set(key, value)
+		return true
+	}
+}
+
+// Pause waits before the next step.
+func Pause(d time.Duration) Step {
+	return func(s *Stream) bool {
+		select {
+		case <-time.After(d):
+			return true
+		case <-s.quit:
+			return false
+		case <-s.r.Context().Done():
+			return false
+		}
+	}
+}
+
+// SlowWrite sends a line a few bytes at a time, pausing between each write,
+// so the client sees partial lines.
+func SlowWrite(line string, chunk int, delay time.Duration) Step {
+	return func(s *Stream) bool {
+		data := line + "\r\n"
+		for len(data) > 0 {
+			n := chunk
+			if n <= 0 || n > len(data) {
+				n = len(data)
+			}
+			if !s.Write(data[:n]) || !Pause(delay)(s) {
+				return false
+			}
+			data = data[n:]
+		}
+		return true
+	}
+}
+
+// Drop closes the connection abruptly, mid stream.
+func Drop() Step {
+	return func(s *Stream) bool {
+		s.start(http.StatusOK)
+		s.w.(http.Flusher).Flush()
+		conn, _, err := s.w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+		return false
+	}
+}
+
+// Hold keeps the connection open until the client goes away or the server
+// is closed.
+func Hold() Step {
+	return func(s *Stream) bool {
+		s.start(http.StatusOK)
+		s.w.(http.Flusher).Flush()
+		select {
+		case <-s.quit:
+		case <-s.r.Context().Done():
+		}
+		return false
+	}
+}
+
+// FlowdockMessage sends a flowdock chat message event.
+// https://www.flowdock.com/api/message-types
+func FlowdockMessage(id int, flow, user, content string) Step {
+	return Message(fmt.Sprintf(`{"event":"message","tags":[],"uuid":null,"id":%d,"flow":%q,"content":%q,"sent":%d,"app":"chat","attachments":[],"user":%q}`,
+		id, flow, content, time.Now().UnixNano()/int64(time.Millisecond), user))
+}
@@ -0,0 +1,156 @@
+package httpstream
+
+// A tiny json scanner, used to pull single values (id_str etc) out of stream
+// messages without doing a full json.Unmarshal on every line.
+
+// jsonLookup finds the raw json value at the given path of object keys, so
+//
+//	jsonLookup(line, "user", "id_str")  =>  []byte(`"608729011"`)
+//
+// returns nil if the path doesn't exist or the data is not a json object.
+func jsonLookup(data []byte, path ...string) []byte {
+	i := skipSpace(data, 0)
+	for _, key := range path {
+		if i >= len(data) || data[i] != '{' {
+			return nil
+		}
+		if i = findKey(data, i+1, key); i < 0 {
+			return nil
+		}
+	}
+	end := skipValue(data, i)
+	if end < 0 {
+		return nil
+	}
+	return data[i:end]
+}
+
+// jsonString looks up a string (or number) value and returns it unquoted, or
+// "" if not found.
+func jsonString(data []byte, path ...string) string {
+	val := jsonLookup(data, path...)
+	if len(val) == 0 {
+		return ""
+	}
+	if val[0] == '"' {
+		s, _ := Unquote(val)
+		return s
+	}
+	if val[0] == '-' || (val[0] >= '0' && val[0] <= '9') {
+		return string(val)
+	}
+	return ""
+}
+
+// findKey scans the members of an object starting just inside the opening
+// brace at i, and returns the offset of the value for key or -1.
+func findKey(data []byte, i int, key string) int {
+	for {
+		i = skipSpace(data, i)
+		if i >= len(data) || data[i] != '"' {
+			return -1
+		}
+		end := skipString(data, i)
+		if end < 0 {
+			return -1
+		}
+		k := data[i:end]
+		i = skipSpace(data, end)
+		if i >= len(data) || data[i] != ':' {
+			return -1
+		}
+		i = skipSpace(data, i+1)
+		if keyEquals(k, key) {
+			return i
+		}
+		if i = skipValue(data, i); i < 0 {
+			return -1
+		}
+		i = skipSpace(data, i)
+		if i >= len(data) || data[i] != ',' {
+			return -1
+		}
+		i++
+	}
+}
+
+// compare a quoted json key to key, only unquoting if it has escapes
+func keyEquals(quoted []byte, key string) bool {
+	if len(quoted) == len(key)+2 && string(quoted[1:len(quoted)-1]) == key {
+		return true
+	}
+	for _, c := range quoted {
+		if c == '\\' {
+			s, ok := Unquote(quoted)
+			return ok && s == key
+		}
+	}
+	return false
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) {
+		switch data[i] {
+		case ' ', '\t', '\r', '\n':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// skipString returns the offset just past the string starting at i
+func skipString(data []byte, i int) int {
+	for i++; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// skipValue returns the offset just past the json value starting at i
+func skipValue(data []byte, i int) int {
+	if i >= len(data) {
+		return -1
+	}
+	switch data[i] {
+	case '"':
+		return skipString(data, i)
+	case '{', '[':
+		depth := 0
+		for ; i < len(data); i++ {
+			switch data[i] {
+			case '"':
+				if i = skipString(data, i); i < 0 {
+					return -1
+				}
+				i--
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+		}
+		return -1
+	}
+	// number, true, false, null
+	start := i
+	for ; i < len(data); i++ {
+		switch data[i] {
+		case ',', '}', ']', ' ', '\t', '\r', '\n':
+			if i == start {
+				return -1
+			}
+			return i
+		}
+	}
+	return i
+}
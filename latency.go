@@ -0,0 +1,198 @@
+package httpstream
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The default number of latency samples kept for percentiles.
+const DefaultLatencyWindow = 1000
+
+// MessageTime returns the time the source created a message: twitter's
+// timestamp_ms (on tweets and deletes) or created_at (data.created_at on v2
+// streams, with tweet.fields=created_at), or flowdock's sent.
+func MessageTime(line []byte) (time.Time, bool) {
+	for _, path := range [][]string{{"timestamp_ms"}, {"delete", "timestamp_ms"}, {"sent"}} {
+		if ms, err := strconv.ParseInt(jsonString(line, path...), 10, 64); err == nil && ms > 0 {
+			return time.Unix(0, ms*int64(time.Millisecond)), true
+		}
+	}
+	if t, ok := parseCreatedAt(jsonString(line, "created_at")); ok {
+		return t, true
+	}
+	return parseCreatedAt(jsonString(line, "data", "created_at"))
+}
+
+// parseCreatedAt parses a v1 (ruby date) or v2 (RFC 3339) created_at
+func parseCreatedAt(created string) (time.Time, bool) {
+	if created == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{time.RubyDate, time.RFC3339} {
+		if t, err := time.Parse(layout, created); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// LatencyConfig configures a LatencyTracker.
+type LatencyConfig struct {
+	// samples kept for percentiles, defaults to DefaultLatencyWindow
+	Window int
+	// finds the source time of a message, defaults to MessageTime
+	SourceTime func(line []byte) (time.Time, bool)
+	// OnLag is called when latency goes over Threshold, it is not called
+	// again until latency has dropped back under.
+	Threshold time.Duration
+	OnLag     func(lag time.Duration, line []byte)
+}
+
+// LatencyStats are the latencies (receive time minus source time) seen on
+// the current connection.
+type LatencyStats struct {
+	// incremented on each (re)connect
+	Connection int
+	// messages with a source time on this connection
+	Samples int64
+	// the latest latency
+	Last time.Duration
+	// percentiles over the window
+	P50, P90, P99, Max time.Duration
+	// whether latency is over the threshold
+	Lagging bool
+}
+
+// LatencyTracker measures how stale messages are when they arrive, per
+// connection.  Add one to a client with Client.TrackLatency.
+type LatencyTracker struct {
+	cfg        LatencyConfig
+	mu         sync.Mutex
+	window     []time.Duration
+	next       int
+	connection int
+	samples    int64
+	last       time.Duration
+	lagging    bool
+}
+
+func NewLatencyTracker(cfg LatencyConfig) *LatencyTracker {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultLatencyWindow
+	}
+	if cfg.SourceTime == nil {
+		cfg.SourceTime = MessageTime
+	}
+	return &LatencyTracker{cfg: cfg, window: make([]time.Duration, 0, cfg.Window)}
+}
+
+// TrackLatency measures the latency of each message as it is read off the
+// stream, before it is queued for the Handler.  Call it before connecting.
+func (c *Client) TrackLatency(cfg LatencyConfig) *LatencyTracker {
+	c.latency = NewLatencyTracker(cfg)
+	return c.latency
+}
+
+// Reset starts a new connection, clearing the samples.
+func (t *LatencyTracker) Reset() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.connection++
+	t.window = t.window[:0]
+	t.next = 0
+	t.samples = 0
+	t.last = 0
+	t.lagging = false
+}
+
+// Observe records the latency of a message received at received, returning
+// it, ok is false if the message has no source time.
+func (t *LatencyTracker) Observe(line []byte, received time.Time) (lag time.Duration, ok bool) {
+	if t == nil {
+		return 0, false
+	}
+	sent, ok := t.cfg.SourceTime(line)
+	if !ok {
+		return 0, false
+	}
+	lag = received.Sub(sent)
+	t.mu.Lock()
+	if len(t.window) < t.cfg.Window {
+		t.window = append(t.window, lag)
+	} else {
+		t.window[t.next] = lag
+		t.next = (t.next + 1) % t.cfg.Window
+	}
+	t.samples++
+	t.last = lag
+	alert := false
+	if t.cfg.Threshold > 0 {
+		over := lag > t.cfg.Threshold
+		alert = over && !t.lagging
+		t.lagging = over
+	}
+	t.mu.Unlock()
+	if alert && t.cfg.OnLag != nil {
+		t.cfg.OnLag(lag, line)
+	}
+	return lag, true
+}
+
+// Middleware observes latency as messages reach it in the pipeline, for use
+// where the tracker isn't attached to a client, ie a WorkerPool's handler.
+func (t *LatencyTracker) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return func(line []byte) {
+			t.Observe(line, time.Now())
+			next(line)
+		}
+	}
+}
+
+// Percentile returns the p (0-100) percentile latency over the window.
+func (t *LatencyTracker) Percentile(p float64) time.Duration {
+	t.mu.Lock()
+	sorted := append([]time.Duration(nil), t.window...)
+	t.mu.Unlock()
+	sort.Sort(durations(sorted))
+	return percentile(sorted, p)
+}
+
+func (t *LatencyTracker) Stats() LatencyStats {
+	t.mu.Lock()
+	stats := LatencyStats{Connection: t.connection, Samples: t.samples, Last: t.last, Lagging: t.lagging}
+	sorted := append([]time.Duration(nil), t.window...)
+	t.mu.Unlock()
+	sort.Sort(durations(sorted))
+	stats.P50 = percentile(sorted, 50)
+	stats.P90 = percentile(sorted, 90)
+	stats.P99 = percentile(sorted, 99)
+	stats.Max = percentile(sorted, 100)
+	return stats
+}
+
+// nearest rank percentile of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	} else if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
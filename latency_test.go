@@ -0,0 +1,114 @@
+package httpstream
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/araddon/httpstream/httpstreamtest"
+)
+
+func TestMessageTime(t *testing.T) {
+	want := time.Date(2012, 9, 17, 21, 26, 40, 0, time.UTC)
+	ms := want.UnixNano() / int64(time.Millisecond)
+	for _, line := range []string{
+		fmt.Sprintf(`{"id_str":"1","text":"hi","timestamp_ms":"%d","created_at":"Mon Jan 02 15:04:05 +0000 2006"}`, ms),
+		`{"id_str":"1","text":"hi","created_at":"Mon Sep 17 21:26:40 +0000 2012"}`,
+		`{"data":{"id":"1","text":"hi","created_at":"2012-09-17T21:26:40.000Z"},"matching_rules":[]}`,
+		fmt.Sprintf(`{"delete":{"status":{"id":1,"id_str":"1"},"timestamp_ms":"%d"}}`, ms),
+		fmt.Sprintf(`{"event":"message","content":"hi","sent":%d}`, ms),
+	} {
+		got, ok := MessageTime([]byte(line))
+		if !ok || !got.Equal(want) {
+			t.Errorf("%s expected %v got %v %v", line, want, got, ok)
+		}
+	}
+	if _, ok := MessageTime([]byte(`{"limit":{"track":1}}`)); ok {
+		t.Error("expected no time for a limit")
+	}
+}
+
+func TestLatencyTracker(t *testing.T) {
+	var alerts []time.Duration
+	tracker := NewLatencyTracker(LatencyConfig{
+		Window:    10,
+		Threshold: 5 * time.Second,
+		OnLag: func(lag time.Duration, line []byte) {
+			alerts = append(alerts, lag)
+		},
+	})
+	sent := time.Now()
+	line := []byte(fmt.Sprintf(`{"timestamp_ms":"%d"}`, sent.UnixNano()/int64(time.Millisecond)))
+	sent, _ = MessageTime(line)
+	// 1..20 seconds, the window keeps 11..20
+	for i := 1; i <= 20; i++ {
+		if lag, ok := tracker.Observe(line, sent.Add(time.Duration(i)*time.Second)); !ok || lag != time.Duration(i)*time.Second {
+			t.Fatalf("expected %ds got %v %v", i, lag, ok)
+		}
+	}
+	if len(alerts) != 1 || alerts[0] != 6*time.Second {
+		t.Errorf("expected one alert at 6s got %v", alerts)
+	}
+	stats := tracker.Stats()
+	if stats.Samples != 20 || stats.P50 != 15*time.Second || stats.P90 != 19*time.Second ||
+		stats.Max != 20*time.Second || !stats.Lagging {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if p := tracker.Percentile(10); p != 11*time.Second {
+		t.Errorf("expected p10 of 11s got %v", p)
+	}
+
+	// back under the threshold, then over again alerts again
+	tracker.Observe(line, sent.Add(time.Second))
+	tracker.Observe(line, sent.Add(8*time.Second))
+	if len(alerts) != 2 {
+		t.Errorf("expected a second alert got %v", alerts)
+	}
+	if _, ok := tracker.Observe([]byte(`{"limit":{"track":1}}`), time.Now()); ok {
+		t.Error("expected no latency for a limit")
+	}
+
+	tracker.Reset()
+	if stats := tracker.Stats(); stats.Connection != 1 || stats.Samples != 0 || stats.P99 != 0 || stats.Lagging {
+		t.Errorf("expected stats cleared on reset %+v", stats)
+	}
+}
+
+func TestClientTrackLatency(t *testing.T) {
+	stale := time.Now().Add(-time.Minute).UnixNano() / int64(time.Millisecond)
+	srv := httpstreamtest.NewServer(httpstreamtest.Script{
+		httpstreamtest.FlowdockMessage(1, "flow", "1", "fresh"),
+		httpstreamtest.Message(fmt.Sprintf(`{"id_str":"2","text":"stale","timestamp_ms":"%d"}`, stale)),
+		httpstreamtest.Hold(),
+	})
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	lines := make(chan []byte, 10)
+	lags := make(chan time.Duration, 10)
+	done := make(chan bool, 1)
+	client := NewBasicAuthClient("user", "pwd", func(line []byte) {
+		lines <- line
+	})
+	tracker := client.TrackLatency(LatencyConfig{Threshold: 30 * time.Second, OnLag: func(lag time.Duration, line []byte) {
+		lags <- lag
+	}})
+	if err := client.Connect(u, nil, done); err != nil {
+		t.Fatal(err)
+	}
+	waitForLines(t, lines, 2)
+	client.Close()
+
+	select {
+	case lag := <-lags:
+		if lag < time.Minute {
+			t.Errorf("expected a lag over a minute got %v", lag)
+		}
+	default:
+		t.Error("expected OnLag to be called")
+	}
+	if stats := tracker.Stats(); stats.Connection != 1 || stats.Samples != 2 || stats.P50 > 10*time.Second {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,217 @@
+package httpstream
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var ErrBadLocations = errors.New("locations must be sets of 4 coordinates: sw lon,sw lat,ne lon,ne lat")
+
+// Matcher re-applies the twitter filter stream rules locally, ie to decide
+// if a tweet would have been delivered for a given track/follow/locations.
+// See https://dev.twitter.com/docs/streaming-apis/parameters
+//
+// As with the stream api, a tweet matches if it matches any of track, follow
+// or locations.
+type Matcher struct {
+	// each phrase is a list of lowercased terms, all of which must match
+	track  [][]string
+	follow map[int64]bool
+	// bounding boxes of sw lon, sw lat, ne lon, ne lat
+	locations [][4]float64
+}
+
+// NewMatcher creates a matcher from the same arguments as Client.Filter
+// @userids list of twitter userids to follow
+// @topics list of track phrases, each may itself be comma delimited
+// @locations list of comma delimited sw lon,sw lat,ne lon,ne lat bounding boxes
+func NewMatcher(userids []int64, topics []string, locations []string) (*Matcher, error) {
+	m := &Matcher{follow: make(map[int64]bool)}
+	for _, id := range userids {
+		if id != 0 {
+			m.follow[id] = true
+		}
+	}
+	for _, phrase := range strings.Split(strings.Join(topics, ","), ",") {
+		if terms := strings.Fields(strings.ToLower(phrase)); len(terms) > 0 {
+			m.track = append(m.track, terms)
+		}
+	}
+	if len(locations) > 0 {
+		parts := strings.Split(strings.Join(locations, ","), ",")
+		if len(parts)%4 != 0 {
+			return nil, ErrBadLocations
+		}
+		for i := 0; i < len(parts); i += 4 {
+			var box [4]float64
+			for j := 0; j < 4; j++ {
+				f, err := strconv.ParseFloat(strings.TrimSpace(parts[i+j]), 64)
+				if err != nil {
+					return nil, ErrBadLocations
+				}
+				box[j] = f
+			}
+			m.locations = append(m.locations, box)
+		}
+	}
+	return m, nil
+}
+
+// Match reports whether the tweet matches any of the track, follow or
+// locations rules.
+func (m *Matcher) Match(tw *Tweet) bool {
+	return m.MatchTrack(tw) || m.MatchFollow(tw) || m.MatchLocations(tw)
+}
+
+// MatchTrack checks the track phrases against the text, expanded and display
+// urls, hashtags and mentioned screen names of the tweet (and the tweet it
+// retweets). A phrase matches if all of its terms are present, in any order,
+// ignoring case.
+func (m *Matcher) MatchTrack(tw *Tweet) bool {
+	if len(m.track) == 0 || tw == nil {
+		return false
+	}
+	doc := newTrackDoc()
+	for t := tw; t != nil; t = t.RetweetedStatus {
+		doc.addTweet(t)
+	}
+	for _, phrase := range m.track {
+		matched := true
+		for _, term := range phrase {
+			if !doc.has(term) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchFollow matches tweets created by a followed user, retweets by or of a
+// followed user, and replies to a followed user.  Manual replies and mentions
+// do not match.
+func (m *Matcher) MatchFollow(tw *Tweet) bool {
+	if len(m.follow) == 0 || tw == nil {
+		return false
+	}
+	return m.follow[tw.User.GetID()] || m.follow[tw.GetInReplyToUserID()] ||
+		m.follow[tw.RetweetedStatus.GetUser().GetID()]
+}
+
+// MatchLocations checks the exact coordinates of the tweet against the
+// bounding boxes, or if there are none, whether the place intersects them.
+func (m *Matcher) MatchLocations(tw *Tweet) bool {
+	if len(m.locations) == 0 || tw == nil {
+		return false
+	}
+	if p, ok := tw.Coordinates.Point(); ok {
+		for _, box := range m.locations {
+			if p.Lon >= box[0] && p.Lon <= box[2] && p.Lat >= box[1] && p.Lat <= box[3] {
+				return true
+			}
+		}
+		return false
+	}
+	if tw.Place == nil {
+		return false
+	}
+	for _, box := range m.locations {
+		if tw.Place.Bounding.Intersects(Point{box[0], box[1]}, Point{box[2], box[3]}) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter is a handler wrapper that only passes on tweets that Match.
+func (m *Matcher) Filter(handler func([]byte)) func([]byte) {
+	return func(line []byte) {
+		tw := Tweet{}
+		if err := json.Unmarshal(line, &tw); err != nil {
+			return
+		}
+		if m.Match(&tw) {
+			handler(line)
+		}
+	}
+}
+
+// the searchable terms of a tweet
+type trackDoc struct {
+	// words split on punctuation, and the #hashtags/@mentions
+	tokens map[string]bool
+	// whitespace delimited words, and urls; for terms containing punctuation
+	words []string
+}
+
+func newTrackDoc() *trackDoc {
+	return &trackDoc{tokens: make(map[string]bool)}
+}
+
+func (d *trackDoc) addTweet(tw *Tweet) {
+	for _, word := range strings.Fields(strings.ToLower(tw.Text)) {
+		d.addWord(word)
+	}
+	for _, u := range tw.Entities.URLs {
+		d.addWord(strings.ToLower(u.GetExpandedURL()))
+		d.addWord(strings.ToLower(u.GetDisplayURL()))
+	}
+	for _, m := range tw.Entities.Media {
+		d.addWord(strings.ToLower(m.ExpandedURL))
+		d.addWord(strings.ToLower(m.DisplayURL))
+	}
+	for _, h := range tw.Entities.Hashtags {
+		d.tokens[strings.ToLower(h.Text)] = true
+	}
+	for _, m := range tw.Entities.UserMentions {
+		d.tokens[strings.ToLower(m.ScreenName)] = true
+	}
+}
+
+func (d *trackDoc) addWord(word string) {
+	if word == "" {
+		return
+	}
+	d.words = append(d.words, word)
+	for _, tok := range strings.FieldsFunc(word, isPunct) {
+		d.tokens[tok] = true
+	}
+}
+
+// has a term; plain terms must match a whole token, so "twitter" matches
+// "#twitter", "twitter." and "http://twitter.com" but not "#newtwitter".
+// Terms with punctuation ("example.com", "twitter's") must match within a word
+// on punctuation boundaries.
+func (d *trackDoc) has(term string) bool {
+	if strings.IndexFunc(term, isPunct) < 0 {
+		return d.tokens[term]
+	}
+	for _, word := range d.words {
+		for i := 0; i+len(term) <= len(word); {
+			idx := strings.Index(word[i:], term)
+			if idx < 0 {
+				break
+			}
+			start, end := i+idx, i+idx+len(term)
+			before, _ := utf8.DecodeLastRuneInString(word[:start])
+			after, _ := utf8.DecodeRuneInString(word[end:])
+			if (start == 0 || isPunct(before)) && (end == len(word) || isPunct(after)) {
+				return true
+			}
+			i = start + 1
+		}
+	}
+	return false
+}
+
+// anything other than letters, digits and underscore (allowed in screen names)
+func isPunct(r rune) bool {
+	return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
@@ -0,0 +1,95 @@
+package httpstream
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// decode the test corpus, data/testdata.json
+func testTweets(t *testing.T) []*Tweet {
+	twlist := make([]*Tweet, 0)
+	for _, js := range tweets {
+		tw := Tweet{}
+		if err := json.Unmarshal([]byte(js), &tw); err != nil {
+			t.Fatal(err)
+		}
+		twlist = append(twlist, &tw)
+	}
+	return twlist
+}
+
+// the indexes into the test corpus that match
+func matching(m *Matcher, twlist []*Tweet) []int {
+	found := make([]int, 0)
+	for i, tw := range twlist {
+		if m.Match(tw) {
+			found = append(found, i)
+		}
+	}
+	return found
+}
+
+func TestMatcher(t *testing.T) {
+	twlist := testTweets(t)
+	tests := []struct {
+		userids   []int64
+		topics    []string
+		locations []string
+		expect    []int
+	}{
+		// text, or mention screen names
+		{topics: []string{"KICKSTARTER"}, expect: []int{0, 1, 2, 3, 4, 5, 6}},
+		// all terms of a phrase, any order
+		{topics: []string{"richmond cycling"}, expect: []int{3}},
+		{topics: []string{"richmond golang"}, expect: []int{}},
+		// comma delimited phrases are or'd
+		{topics: []string{"golang,numenera", "vevo"}, expect: []int{6, 7, 8}},
+		// hashtags, but not partial words
+		{topics: []string{"nowplaying"}, expect: []int{7, 9}},
+		{topics: []string{"certified"}, expect: []int{}},
+		// expanded and display urls, including of the retweeted tweet
+		{topics: []string{"kck.st"}, expect: []int{0, 2, 3, 5, 6}},
+		{topics: []string{"titan"}, expect: []int{4}},
+		// punctuation within a term
+		{topics: []string{"richmond's"}, expect: []int{3}},
+		// author, retweeted user
+		{userids: []int64{28444416, 28201743}, expect: []int{1, 8}},
+		// a tweet with exact coordinates, and the place fragment
+		{locations: []string{"-88.1,41.9,-88.0,42.0"}, expect: []int{10}},
+		// place bounding box intersects, coordinates do not
+		{locations: []string{"-88.04,41.95,-88.03,41.96"}, expect: []int{}},
+		{locations: []string{"-122.75,36.8,-121.75,37.8", "-74,40,-73,41"}, expect: []int{}},
+	}
+	for _, test := range tests {
+		m, err := NewMatcher(test.userids, test.topics, test.locations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found := matching(m, twlist); !equalInts(found, test.expect) {
+			t.Errorf("%v %v %v expected %v got %v", test.userids, test.topics, test.locations, test.expect, found)
+		}
+	}
+
+	place := twlist[10]
+	place.Coordinates = nil
+	m, _ := NewMatcher(nil, nil, []string{"-88.04,41.95,-88.03,41.96"})
+	if !m.Match(place) {
+		t.Error("expected the place bounding box to intersect")
+	}
+
+	if _, err := NewMatcher(nil, nil, []string{"-88.04,41.95,-88.03"}); err != ErrBadLocations {
+		t.Errorf("expected ErrBadLocations got %v", err)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,300 @@
+package httpstream
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The upper bounds, in seconds, of the handler latency histogram buckets.
+var LatencyBuckets = []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5}
+
+// Reconnect causes
+const (
+	// the stream ended
+	CauseEOF = "eof"
+	// reading the stream failed, ie connection reset
+	CauseReadError = "read_error"
+	// the previous reconnect attempt could not connect
+	CauseConnectError = "connect_error"
+	// the previous reconnect attempt got this http status, ie http_420
+	CauseHTTPPrefix = "http_"
+)
+
+// MessageType classifies a twitter (or flowdock) stream message by its top
+// level key: tweet (v1 or v2), delete, scrub_geo, limit, status_withheld,
+// user_withheld, disconnect, warning, friends, event, direct_message,
+// errors (v2), or other.
+func MessageType(line []byte) string {
+	if isTweet(line) {
+		return "tweet"
+	}
+	for _, key := range messageTypes {
+		if jsonLookup(line, key) != nil {
+			return key
+		}
+	}
+	return "other"
+}
+
+var messageTypes = []string{"delete", "scrub_geo", "limit", "status_withheld", "user_withheld",
+	"disconnect", "warning", "friends", "event", "direct_message", "errors"}
+
+// isTweet is whether line is a v1 tweet, or a v2 one in its data envelope
+func isTweet(line []byte) bool {
+	if jsonLookup(line, "id_str") != nil && jsonLookup(line, "text") != nil {
+		return true
+	}
+	return jsonLookup(line, "data", "id") != nil && jsonLookup(line, "data", "text") != nil
+}
+
+// StreamMetrics are counters and gauges for a Client's connections, turn
+// them on with Client.Instrument.  StreamMetrics is an http.Handler serving
+// them in the Prometheus text format:
+//
+//	m := client.Instrument()
+//	http.Handle("/metrics", m)
+//	m.Publish("httpstream")  // and/or on /debug/vars
+type StreamMetrics struct {
+	// names the type of each message for the by type counts, defaults to
+	// MessageType.  Set it before connecting.
+	Classify func(line []byte) string
+	messages int64
+	bytes    int64
+	// gauges, the backoff wait in nanoseconds and unix nanoseconds
+	backoff     int64
+	connectedAt int64
+	lastByte    int64
+	mu          sync.Mutex
+	byType      map[string]int64
+	reconnects  map[string]int64
+	latency     []int64
+	latencySum  time.Duration
+	latencyN    int64
+}
+
+func NewStreamMetrics() *StreamMetrics {
+	return &StreamMetrics{
+		Classify:   MessageType,
+		byType:     make(map[string]int64),
+		reconnects: make(map[string]int64),
+		latency:    make([]int64, len(LatencyBuckets)),
+	}
+}
+
+// Instrument turns on metrics for the client's connections, returning them.
+// Call it before connecting, further calls return the same metrics.
+func (c *Client) Instrument() *StreamMetrics {
+	if c.metrics == nil {
+		c.metrics = NewStreamMetrics()
+	}
+	return c.metrics
+}
+
+// the methods the stream reader calls, a nil *StreamMetrics ignores them
+
+func (m *StreamMetrics) connected() {
+	if m != nil {
+		now := time.Now().UnixNano()
+		atomic.StoreInt64(&m.connectedAt, now)
+		atomic.StoreInt64(&m.lastByte, now)
+		atomic.StoreInt64(&m.backoff, 0)
+	}
+}
+
+func (m *StreamMetrics) disconnected() {
+	if m != nil {
+		atomic.StoreInt64(&m.connectedAt, 0)
+	}
+}
+
+func (m *StreamMetrics) received(n int) {
+	if m != nil {
+		atomic.AddInt64(&m.bytes, int64(n))
+		atomic.StoreInt64(&m.lastByte, time.Now().UnixNano())
+	}
+}
+
+func (m *StreamMetrics) message(line []byte) {
+	if m == nil {
+		return
+	}
+	atomic.AddInt64(&m.messages, 1)
+	kind := "other"
+	if m.Classify != nil {
+		kind = m.Classify(line)
+	}
+	m.mu.Lock()
+	m.byType[kind]++
+	m.mu.Unlock()
+}
+
+func (m *StreamMetrics) reconnecting(cause string, wait time.Duration) {
+	if m != nil {
+		atomic.StoreInt64(&m.backoff, int64(wait))
+		m.mu.Lock()
+		m.reconnects[cause]++
+		m.mu.Unlock()
+	}
+}
+
+func (m *StreamMetrics) handled(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, le := range LatencyBuckets {
+		if d.Seconds() <= le {
+			m.latency[i]++
+			break
+		}
+	}
+	m.latencySum += d
+	m.latencyN++
+}
+
+// middleware timing the rest of the pipeline
+func (m *StreamMetrics) timing(next Handler) Handler {
+	return func(line []byte) {
+		start := time.Now()
+		defer func() {
+			m.handled(time.Since(start))
+		}()
+		next(line)
+	}
+}
+
+// LatencyHistogram is a snapshot of the handler latency histogram.
+type LatencyHistogram struct {
+	// the upper bounds in seconds, see LatencyBuckets
+	Buckets []float64
+	// the number of messages in each bucket (not cumulative), the last is
+	// for those over the largest bound
+	Counts []int64
+	Sum    time.Duration
+	Count  int64
+}
+
+// MetricsSnapshot is a point in time copy of StreamMetrics.
+type MetricsSnapshot struct {
+	Messages int64
+	Bytes    int64
+	ByType   map[string]int64
+	// reconnect attempts by cause, see CauseEOF etc
+	Reconnects map[string]int64
+	// the current wait before the next reconnect attempt
+	Backoff   time.Duration
+	Connected bool
+	// how long the current connection has been up, 0 when disconnected
+	Uptime        time.Duration
+	SinceLastByte time.Duration
+	Latency       LatencyHistogram
+}
+
+func (m *StreamMetrics) Snapshot() MetricsSnapshot {
+	now := time.Now()
+	snap := MetricsSnapshot{
+		Messages:   atomic.LoadInt64(&m.messages),
+		Bytes:      atomic.LoadInt64(&m.bytes),
+		ByType:     make(map[string]int64),
+		Reconnects: make(map[string]int64),
+		Backoff:    time.Duration(atomic.LoadInt64(&m.backoff)),
+	}
+	if at := atomic.LoadInt64(&m.connectedAt); at != 0 {
+		snap.Connected = true
+		snap.Uptime = now.Sub(time.Unix(0, at))
+	}
+	if at := atomic.LoadInt64(&m.lastByte); at != 0 {
+		snap.SinceLastByte = now.Sub(time.Unix(0, at))
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, v := range m.byType {
+		snap.ByType[k] = v
+	}
+	for k, v := range m.reconnects {
+		snap.Reconnects[k] = v
+	}
+	var counted int64
+	snap.Latency = LatencyHistogram{Buckets: LatencyBuckets, Counts: make([]int64, len(LatencyBuckets)+1), Sum: m.latencySum, Count: m.latencyN}
+	for i, n := range m.latency {
+		snap.Latency.Counts[i] = n
+		counted += n
+	}
+	snap.Latency.Counts[len(LatencyBuckets)] = m.latencyN - counted
+	return snap
+}
+
+// Publish the metrics snapshot as an expvar, it panics if name is already
+// published.
+func (m *StreamMetrics) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return m.Snapshot()
+	}))
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format.
+func (m *StreamMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buf.Bytes())
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *StreamMetrics) WriteTo(w io.Writer) (int64, error) {
+	snap := m.Snapshot()
+	var buf bytes.Buffer
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(&buf, "# HELP httpstream_%s %s\n# TYPE httpstream_%s %s\n", name, help, name, kind)
+	}
+	labelled := func(name, label string, values map[string]int64) {
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&buf, "httpstream_%s{%s=\"%s\"} %d\n", name, label, labelEscaper.Replace(k), values[k])
+		}
+	}
+	connected := 0
+	if snap.Connected {
+		connected = 1
+	}
+
+	metric("messages_total", "counter", "Messages received.")
+	fmt.Fprintf(&buf, "httpstream_messages_total %d\n", snap.Messages)
+	metric("bytes_total", "counter", "Bytes received, including keep alives.")
+	fmt.Fprintf(&buf, "httpstream_bytes_total %d\n", snap.Bytes)
+	metric("messages_by_type_total", "counter", "Messages received by type.")
+	labelled("messages_by_type_total", "type", snap.ByType)
+	metric("reconnects_total", "counter", "Reconnect attempts by cause.")
+	labelled("reconnects_total", "cause", snap.Reconnects)
+	metric("backoff_seconds", "gauge", "Current wait before the next reconnect attempt.")
+	fmt.Fprintf(&buf, "httpstream_backoff_seconds %g\n", snap.Backoff.Seconds())
+	metric("connected", "gauge", "1 if the stream is connected.")
+	fmt.Fprintf(&buf, "httpstream_connected %d\n", connected)
+	metric("uptime_seconds", "gauge", "Time the current connection has been up.")
+	fmt.Fprintf(&buf, "httpstream_uptime_seconds %g\n", snap.Uptime.Seconds())
+	metric("last_byte_age_seconds", "gauge", "Time since the last byte was received.")
+	fmt.Fprintf(&buf, "httpstream_last_byte_age_seconds %g\n", snap.SinceLastByte.Seconds())
+
+	metric("handler_latency_seconds", "histogram", "Time taken by the middleware and Handler per message.")
+	var cumulative int64
+	for i, le := range snap.Latency.Buckets {
+		cumulative += snap.Latency.Counts[i]
+		fmt.Fprintf(&buf, "httpstream_handler_latency_seconds_bucket{le=\"%g\"} %d\n", le, cumulative)
+	}
+	fmt.Fprintf(&buf, "httpstream_handler_latency_seconds_bucket{le=\"+Inf\"} %d\n", snap.Latency.Count)
+	fmt.Fprintf(&buf, "httpstream_handler_latency_seconds_sum %g\n", snap.Latency.Sum.Seconds())
+	fmt.Fprintf(&buf, "httpstream_handler_latency_seconds_count %d\n", snap.Latency.Count)
+	return buf.WriteTo(w)
+}
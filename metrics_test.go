@@ -0,0 +1,123 @@
+package httpstream
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/araddon/httpstream/httpstreamtest"
+)
+
+func TestMessageType(t *testing.T) {
+	for line, want := range map[string]string{
+		`{"id_str":"1","text":"hi"}`:                              "tweet",
+		`{"delete":{"status":{"id":1234,"id_str":"1234"}}}`:       "delete",
+		`{"limit":{"track":1234}}`:                                "limit",
+		`{"warning":{"code":"FALLING_BEHIND","percent_full":60}}`: "warning",
+		`{"event":"message","content":"hi"}`:                      "event",
+		`{"data":{"id":"1","text":"hi"},"matching_rules":[]}`:     "tweet",
+		`{"errors":[{"title":"operational-disconnect"}]}`:         "errors",
+		`{"something":"else"}`:                                    "other",
+	} {
+		if got := MessageType([]byte(line)); got != want {
+			t.Errorf("%s expected %s got %s", line, want, got)
+		}
+	}
+}
+
+func TestStreamMetrics(t *testing.T) {
+	srv := httpstreamtest.NewServer(
+		httpstreamtest.Script{
+			httpstreamtest.Message(`{"id_str":"1","text":"one"}`),
+			httpstreamtest.Message(`{"delete":{"status":{"id":1,"id_str":"1"}}}`),
+			httpstreamtest.KeepAlive(),
+			httpstreamtest.Drop(),
+		},
+		httpstreamtest.Script{httpstreamtest.Status(503)},
+		httpstreamtest.Script{
+			httpstreamtest.Message(`{"id_str":"2","text":"two"}`),
+			httpstreamtest.Hold(),
+		},
+	)
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	lines := make(chan []byte, 10)
+	done := make(chan bool, 1)
+	client := NewBasicAuthClient("user", "pwd", func(line []byte) {
+		lines <- line
+	})
+	m := client.Instrument()
+	if err := client.Connect(u, nil, done); err != nil {
+		t.Fatal(err)
+	}
+	waitForLines(t, lines, 3)
+
+	snap := m.Snapshot()
+	if snap.Messages != 3 || snap.ByType["tweet"] != 2 || snap.ByType["delete"] != 1 {
+		t.Errorf("unexpected message counts %v %v", snap.Messages, snap.ByType)
+	}
+	if snap.Bytes < 80 {
+		t.Errorf("expected bytes counted got %d", snap.Bytes)
+	}
+	if snap.Reconnects[CauseEOF]+snap.Reconnects[CauseReadError] != 1 || snap.Reconnects["http_503"] != 1 {
+		t.Errorf("unexpected reconnects %v", snap.Reconnects)
+	}
+	if !snap.Connected || snap.Backoff != 0 {
+		t.Errorf("expected connected with no backoff %v %v", snap.Connected, snap.Backoff)
+	}
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE httpstream_messages_total counter\nhttpstream_messages_total 3\n",
+		`httpstream_messages_by_type_total{type="delete"} 1` + "\n",
+		`httpstream_reconnects_total{cause="http_503"} 1` + "\n",
+		"httpstream_connected 1\n",
+		`httpstream_handler_latency_seconds_bucket{le="+Inf"} 3` + "\n",
+		"httpstream_handler_latency_seconds_count 3\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in\n%s", want, body)
+		}
+	}
+
+	client.Close()
+	if m.Snapshot().Connected {
+		t.Error("expected disconnected after Close")
+	}
+}
+
+func TestStreamMetricsReconnect(t *testing.T) {
+	srv := httpstreamtest.NewServer(
+		httpstreamtest.Script{httpstreamtest.Message(`{"id_str":"1","text":"one"}`), httpstreamtest.Hold()},
+		httpstreamtest.Script{httpstreamtest.Message(`{"id_str":"2","text":"two"}`), httpstreamtest.Hold()},
+	)
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	lines := make(chan []byte, 10)
+	client := NewClient(func(line []byte) { lines <- line })
+	m := client.Instrument()
+	if err := client.Connect(u, nil, make(chan bool, 1)); err != nil {
+		t.Fatal(err)
+	}
+	waitForLines(t, lines, 1)
+	// a second Connect replaces the first connection, whose reader closes
+	// it again once it notices
+	if err := client.Connect(u, nil, make(chan bool, 1)); err != nil {
+		t.Fatal(err)
+	}
+	waitForLines(t, lines, 1)
+	time.Sleep(200 * time.Millisecond)
+	if snap := m.Snapshot(); !snap.Connected || snap.Uptime <= 0 {
+		t.Errorf("expected connected after a second Connect got %v %v", snap.Connected, snap.Uptime)
+	}
+	client.Close()
+	if m.Snapshot().Connected {
+		t.Error("expected disconnected after Close")
+	}
+}
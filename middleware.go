@@ -0,0 +1,102 @@
+package httpstream
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Handler handles one message (line) from the stream.
+type Handler func([]byte)
+
+// Middleware wraps a Handler, to filter, transform or observe messages on
+// their way to it.
+type Middleware func(Handler) Handler
+
+// Use adds middleware to the client's pipeline.  Middleware runs in the order
+// it was added, so the first added sees each message first:
+//
+//	client.Use(httpstream.Recovery(nil), httpstream.OnlyTweets(), httpstream.Dedupe(10000))
+//
+// The pipeline is built on Connect, so Use should be called before connecting.
+func (c *Client) Use(mw ...Middleware) {
+	c.middleware = append(c.middleware, mw...)
+}
+
+// Chain wraps handler in the middleware, the first being outermost.
+func Chain(handler Handler, mw ...Middleware) Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		handler = mw[i](handler)
+	}
+	return handler
+}
+
+// Recovery recovers from panics further down the pipeline, logging them and
+// passing them to onErr (which may be nil) as a *HandlerPanic.
+func Recovery(onErr func(err error, line []byte)) Middleware {
+	return func(next Handler) Handler {
+		return func(line []byte) {
+			safeHandle(next, line, onErr)
+		}
+	}
+}
+
+// Filtering only passes on messages for which keep returns true.
+func Filtering(keep func(line []byte) bool) Middleware {
+	return func(next Handler) Handler {
+		return func(line []byte) {
+			if keep(line) {
+				next(line)
+			}
+		}
+	}
+}
+
+// OnlyTweets drops the non tweet messages (deletes, limits, warnings, etc).
+func OnlyTweets() Middleware {
+	return Filtering(func(line []byte) bool {
+		return isTweet(line)
+	})
+}
+
+// Dedupe drops tweets whose id_str is one of the last size ids seen, see
+// Deduper for more options.
+func Dedupe(size int) Middleware {
+	return NewDeduper(DedupeConfig{Size: size}).Middleware()
+}
+
+// HandlerMetrics are counters updated by the Metrics middleware, read them
+// with Stats.
+type HandlerMetrics struct {
+	messages int64
+	bytes    int64
+	nanos    int64
+}
+
+// HandlerStats is a snapshot of HandlerMetrics
+type HandlerStats struct {
+	Messages int64
+	Bytes    int64
+	// total time spent in the rest of the pipeline
+	Duration time.Duration
+}
+
+func (m *HandlerMetrics) Stats() HandlerStats {
+	return HandlerStats{
+		Messages: atomic.LoadInt64(&m.messages),
+		Bytes:    atomic.LoadInt64(&m.bytes),
+		Duration: time.Duration(atomic.LoadInt64(&m.nanos)),
+	}
+}
+
+// Metrics counts messages, bytes and time spent handling them into m.
+func Metrics(m *HandlerMetrics) Middleware {
+	return func(next Handler) Handler {
+		return func(line []byte) {
+			start := time.Now()
+			next(line)
+			atomic.AddInt64(&m.nanos, int64(time.Since(start)))
+			atomic.AddInt64(&m.messages, 1)
+			atomic.AddInt64(&m.bytes, int64(len(line)))
+		}
+	}
+}
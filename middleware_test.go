@@ -0,0 +1,64 @@
+package httpstream
+
+import (
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	order := make([]string, 0)
+	mark := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(line []byte) {
+				order = append(order, name)
+				next(line)
+			}
+		}
+	}
+	handled := make([]string, 0)
+	c := NewClient(func(line []byte) {
+		handled = append(handled, jsonString(line, "id_str"))
+	})
+	c.QueueSize = 0
+	c.Use(mark("a"), OnlyTweets(), mark("b"))
+	c.Use(Dedupe(10))
+	deliver := c.deliverer(mark("first"))
+
+	deliver([]byte(`{"id_str":"1","text":"hi"}`))
+	if len(order) != 3 || order[0] != "first" || order[1] != "a" || order[2] != "b" {
+		t.Errorf("expected middleware in order they were added got %v", order)
+	}
+	deliver([]byte(`{"delete":{"status":{"id_str":"1"}}}`))
+	deliver([]byte(`{"id_str":"1","text":"hi"}`))
+	deliver([]byte(`{"id_str":"2","text":"hi"}`))
+	if len(handled) != 2 || handled[0] != "1" || handled[1] != "2" {
+		t.Errorf("expected deletes and duplicates dropped got %v", handled)
+	}
+	if c.Handler == nil || len(c.middleware) != 4 {
+		t.Error("deliverer should not modify the client")
+	}
+
+	// onlyTweetsFilter passes tweets, not deletes
+	n := 0
+	h := OnlyTweetsFilter(func(line []byte) { n++ })
+	h([]byte(`{"delete":{"status":{"id_str":"1"}}}`))
+	h([]byte(tweets[0]))
+	if n != 1 {
+		t.Errorf("expected only the tweet got %d", n)
+	}
+
+	var m HandlerMetrics
+	var panicked error
+	h = Chain(func(line []byte) { panic("bad line") }, Recovery(func(err error, line []byte) { panicked = err }), Metrics(&m))
+	h([]byte("abc"))
+	if _, ok := panicked.(*HandlerPanic); !ok {
+		t.Errorf("expected a HandlerPanic got %v", panicked)
+	}
+	if stats := m.Stats(); stats.Messages != 0 {
+		t.Errorf("a panicking handler is not counted %+v", stats)
+	}
+	h = Chain(func(line []byte) {}, Metrics(&m))
+	h([]byte("abc"))
+	if stats := m.Stats(); stats.Messages != 1 || stats.Bytes != 3 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,258 @@
+package httpstream
+
+import (
+	"strconv"
+	"time"
+)
+
+// NormalizedTweet is a tweet in the same shape whether it came from the v1.1
+// or v2 api, ie for storing both in one schema:
+//
+//	var nt *httpstream.NormalizedTweet
+//	if v2 {
+//		nt = msg.Normalize()    // a *StreamResponseV2
+//	} else {
+//		nt = tweet.Normalize()  // a *Tweet
+//	}
+//
+// Retweets and quotes keep the original tweet in their References, see
+// Original.  What is filled in depends on what the source sent, for v2 the
+// fields and expansions asked for.
+type NormalizedTweet struct {
+	ID string `json:"id"`
+	// 1 or 2
+	APIVersion int            `json:"api_version"`
+	Text       string         `json:"text"`
+	CreatedAt  time.Time      `json:"created_at"`
+	Lang       string         `json:"lang,omitempty"`
+	Source     string         `json:"source,omitempty"`
+	Sensitive  bool           `json:"possibly_sensitive,omitempty"`
+	Author     NormalizedUser `json:"author"`
+	// the user replied to, if a reply
+	InReplyToUserID string            `json:"in_reply_to_user_id,omitempty"`
+	Hashtags        []string          `json:"hashtags,omitempty"`
+	Mentions        []string          `json:"mentions,omitempty"`
+	URLs            []string          `json:"urls,omitempty"`
+	Media           []NormalizedMedia `json:"media,omitempty"`
+	Geo             *NormalizedGeo    `json:"geo,omitempty"`
+	RetweetCount    int               `json:"retweet_count"`
+	References      []NormalizedRef   `json:"references,omitempty"`
+}
+
+type NormalizedUser struct {
+	ID              string `json:"id"`
+	Username        string `json:"username,omitempty"`
+	Name            string `json:"name,omitempty"`
+	Verified        bool   `json:"verified,omitempty"`
+	FollowersCount  int    `json:"followers_count,omitempty"`
+	ProfileImageURL string `json:"profile_image_url,omitempty"`
+}
+
+type NormalizedMedia struct {
+	// the media id (v1) or media key (v2)
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	URL  string `json:"url,omitempty"`
+}
+
+// NormalizedGeo is where a tweet was sent from, see Tweet.Location.
+type NormalizedGeo struct {
+	Point       Point     `json:"point"`
+	Precision   Precision `json:"precision"`
+	PlaceID     string    `json:"place_id,omitempty"`
+	PlaceName   string    `json:"place_name,omitempty"`
+	CountryCode string    `json:"country_code,omitempty"`
+}
+
+// The types of NormalizedRef, as in the v2 api
+const (
+	RefRetweeted = "retweeted"
+	RefQuoted    = "quoted"
+	RefRepliedTo = "replied_to"
+)
+
+// NormalizedRef is a tweet this one retweets, quotes or replies to.
+type NormalizedRef struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	// nil if the source didn't include it
+	Tweet *NormalizedTweet `json:"tweet,omitempty"`
+}
+
+// Original returns the tweet that t retweets, if it was included, or else t.
+func (t *NormalizedTweet) Original() *NormalizedTweet {
+	if ref := t.Ref(RefRetweeted); ref != nil && ref.Tweet != nil {
+		return ref.Tweet
+	}
+	return t
+}
+
+// Ref returns t's reference of the given type, nil if it has none.
+func (t *NormalizedTweet) Ref(refType string) *NormalizedRef {
+	for i := range t.References {
+		if t.References[i].Type == refType {
+			return &t.References[i]
+		}
+	}
+	return nil
+}
+
+// Normalize converts a v1.1 tweet, along with the tweets it retweets or
+// quotes.
+func (t *Tweet) Normalize() *NormalizedTweet {
+	if t == nil {
+		return nil
+	}
+	nt := &NormalizedTweet{
+		ID:           t.IDStr,
+		APIVersion:   1,
+		Text:         t.Text,
+		Lang:         t.Lang,
+		Source:       t.Source,
+		Sensitive:    t.GetPossiblySensitive(),
+		Hashtags:     t.Hashes(),
+		Mentions:     t.Mentions(),
+		URLs:         t.URLs(),
+		RetweetCount: int(t.RetweetCount),
+	}
+	if nt.ID == "" && t.ID != nil {
+		nt.ID = strconv.FormatInt(*t.ID, 10)
+	}
+	nt.CreatedAt, _ = parseCreatedAt(t.CreatedAt)
+	if u := t.User; u != nil {
+		nt.Author = NormalizedUser{
+			ID:              u.GetIDStr(),
+			Username:        u.ScreenName,
+			Name:            u.Name,
+			Verified:        u.Verified,
+			FollowersCount:  u.Followerscount,
+			ProfileImageURL: u.ProfileImageURL,
+		}
+		if nt.Author.ID == "" && u.ID != nil {
+			nt.Author.ID = strconv.FormatInt(*u.ID, 10)
+		}
+	}
+	if t.InReplyToUserID != nil {
+		nt.InReplyToUserID = strconv.FormatInt(*t.InReplyToUserID, 10)
+	}
+	for _, m := range t.Entities.Media {
+		id := m.IDStr
+		if id == "" {
+			id = strconv.FormatInt(m.ID, 10)
+		}
+		nt.Media = append(nt.Media, NormalizedMedia{ID: id, Type: m.Type, URL: m.MediaURLHTTPS})
+	}
+	if p, precision := t.Location(); precision != PrecisionNone {
+		nt.Geo = &NormalizedGeo{Point: p, Precision: precision}
+		if t.Place != nil {
+			nt.Geo.PlaceID = t.Place.ID
+			nt.Geo.PlaceName = t.Place.FullName
+			nt.Geo.CountryCode = t.Place.CountryCode
+		}
+	}
+
+	if rt := t.RetweetedStatus; rt != nil {
+		nt.References = append(nt.References, NormalizedRef{Type: RefRetweeted, ID: rt.IDStr, Tweet: rt.Normalize()})
+	}
+	if q := t.QuotedStatus; q != nil {
+		nt.References = append(nt.References, NormalizedRef{Type: RefQuoted, ID: q.IDStr, Tweet: q.Normalize()})
+	} else if t.QuotedStatusIDStr != "" {
+		nt.References = append(nt.References, NormalizedRef{Type: RefQuoted, ID: t.QuotedStatusIDStr})
+	}
+	if t.InReplyToStatusID != nil {
+		nt.References = append(nt.References, NormalizedRef{Type: RefRepliedTo, ID: strconv.FormatInt(*t.InReplyToStatusID, 10)})
+	}
+	return nt
+}
+
+// Normalize converts a v2 tweet, which should have been hydrated (see
+// StreamResponseV2.Hydrate) for the author, media, place and referenced
+// tweets to be filled in.
+func (t *TweetV2) Normalize() *NormalizedTweet {
+	return t.normalize(0)
+}
+
+// referenced tweets are followed this deep, includes may refer to each other
+const maxNormalizeDepth = 2
+
+func (t *TweetV2) normalize(depth int) *NormalizedTweet {
+	if t == nil {
+		return nil
+	}
+	nt := &NormalizedTweet{
+		ID:              t.ID,
+		APIVersion:      2,
+		Text:            t.Text,
+		Lang:            t.Lang,
+		Source:          t.Source,
+		Sensitive:       t.PossiblySensitive,
+		Author:          NormalizedUser{ID: t.AuthorID},
+		InReplyToUserID: t.InReplyToUserID,
+		Hashtags:        t.Hashes(),
+		Mentions:        t.Mentions(),
+		URLs:            t.URLs(),
+	}
+	nt.CreatedAt, _ = parseCreatedAt(t.CreatedAt)
+	if t.PublicMetrics != nil {
+		nt.RetweetCount = t.PublicMetrics.RetweetCount
+	}
+	if u := t.Author; u != nil {
+		nt.Author = NormalizedUser{
+			ID:              u.ID,
+			Username:        u.Username,
+			Name:            u.Name,
+			Verified:        u.Verified,
+			ProfileImageURL: u.ProfileImageURL,
+		}
+		if u.PublicMetrics != nil {
+			nt.Author.FollowersCount = u.PublicMetrics.FollowersCount
+		}
+	}
+	for _, m := range t.Media {
+		url := m.URL
+		if url == "" {
+			url = m.PreviewImageURL
+		}
+		nt.Media = append(nt.Media, NormalizedMedia{ID: m.MediaKey, Type: m.Type, URL: url})
+	}
+	if t.Geo != nil {
+		if p, ok := t.Geo.Coordinates.Point(); ok {
+			nt.Geo = &NormalizedGeo{Point: p, Precision: PrecisionExact}
+		} else if p, ok := t.Place.centroid(); ok {
+			nt.Geo = &NormalizedGeo{Point: p, Precision: PrecisionPlace}
+		}
+		if nt.Geo != nil {
+			nt.Geo.PlaceID = t.Geo.PlaceID
+			if t.Place != nil {
+				nt.Geo.PlaceName = t.Place.FullName
+				nt.Geo.CountryCode = t.Place.CountryCode
+			}
+		}
+	}
+	for _, ref := range t.ReferencedTweets {
+		nref := NormalizedRef{Type: ref.Type, ID: ref.ID}
+		if depth < maxNormalizeDepth {
+			nref.Tweet = ref.Tweet.normalize(depth + 1)
+		}
+		nt.References = append(nt.References, nref)
+	}
+	return nt
+}
+
+// centroid of the place's bbox, [west, south, east, north]
+func (p *PlaceV2) centroid() (Point, bool) {
+	if p == nil || p.Geo == nil || len(p.Geo.BBox) != 4 {
+		return Point{}, false
+	}
+	b := p.Geo.BBox
+	return Point{(b[0] + b[2]) / 2, (b[1] + b[3]) / 2}, true
+}
+
+// Normalize hydrates and converts the response's tweet, nil if it has none.
+func (r *StreamResponseV2) Normalize() *NormalizedTweet {
+	if r.Data == nil {
+		return nil
+	}
+	r.Hydrate()
+	return r.Data.Normalize()
+}
@@ -0,0 +1,105 @@
+package httpstream
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormalizeTweet(t *testing.T) {
+	line := `{"id":3,"id_str":"3","text":"RT @bob: look #go","lang":"en","created_at":"Wed Aug 27 13:08:45 +0000 2008",
+		"user":{"id":10,"id_str":"10","screen_name":"alice","name":"Alice","followers_count":5},
+		"entities":{"hashtags":[{"text":"go","indices":[14,17]}],"user_mentions":[{"screen_name":"bob","id_str":"11","indices":[3,7]}],"urls":[]},
+		"retweeted_status":{"id_str":"2","text":"look #go https://t.co/x","created_at":"Wed Aug 27 12:00:00 +0000 2008",
+			"user":{"id_str":"11","screen_name":"bob"},
+			"entities":{"hashtags":[{"text":"go","indices":[5,8]}],"urls":[{"url":"https://t.co/x","expanded_url":"https://golang.org","indices":[9,23]}],
+				"media":[{"id_str":"99","type":"photo","media_url_https":"https://pbs.twimg.com/media/1.jpg"}]},
+			"quoted_status_id_str":"1",
+			"quoted_status":{"id_str":"1","text":"original","user":{"id_str":"12","screen_name":"carol"},"entities":{}},
+			"place":{"id":"p1","full_name":"Itasca, IL","country_code":"US",
+				"bounding_box":{"type":"Polygon","coordinates":[[[-88,41],[-88,42],[-87,42],[-87,41]]]}}}}`
+	var tw Tweet
+	if err := json.Unmarshal([]byte(line), &tw); err != nil {
+		t.Fatal(err)
+	}
+	nt := tw.Normalize()
+	if nt.ID != "3" || nt.APIVersion != 1 || nt.Author.Username != "alice" || nt.Author.FollowersCount != 5 || nt.Lang != "en" {
+		t.Errorf("unexpected tweet %+v", nt)
+	}
+	if want := time.Date(2008, 8, 27, 13, 8, 45, 0, time.UTC); !nt.CreatedAt.Equal(want) {
+		t.Errorf("expected %v got %v", want, nt.CreatedAt)
+	}
+	if !reflect.DeepEqual(nt.Mentions, []string{"bob"}) || !reflect.DeepEqual(nt.Hashtags, []string{"go"}) {
+		t.Errorf("unexpected entities %v %v", nt.Mentions, nt.Hashtags)
+	}
+
+	orig := nt.Original()
+	if orig == nt || orig.ID != "2" || orig.Author.Username != "bob" {
+		t.Fatalf("expected the retweeted tweet got %+v", orig)
+	}
+	if !reflect.DeepEqual(orig.URLs, []string{"https://golang.org"}) || len(orig.Media) != 1 || orig.Media[0].ID != "99" {
+		t.Errorf("unexpected entities %v %v", orig.URLs, orig.Media)
+	}
+	if orig.Geo == nil || orig.Geo.Precision != PrecisionPlace || orig.Geo.PlaceName != "Itasca, IL" || orig.Geo.Point != (Point{-87.5, 41.5}) {
+		t.Errorf("unexpected geo %+v", orig.Geo)
+	}
+	quoted := orig.Ref(RefQuoted)
+	if quoted == nil || quoted.ID != "1" || quoted.Tweet == nil || quoted.Tweet.Author.Username != "carol" {
+		t.Errorf("expected the quoted tweet got %+v", quoted)
+	}
+	if nt.Ref(RefQuoted) != nil || orig.Original() != orig {
+		t.Error("expected the retweet itself to have no quote")
+	}
+}
+
+func TestNormalizeTweetV2(t *testing.T) {
+	line := `{"data":{"id":"3","text":"@bob look #go","author_id":"10","created_at":"2021-03-04T05:06:07.000Z","lang":"en",
+		"in_reply_to_user_id":"11","geo":{"place_id":"p1"},"attachments":{"media_keys":["3_1"]},
+		"referenced_tweets":[{"type":"replied_to","id":"2"},{"type":"quoted","id":"1"}],
+		"entities":{"hashtags":[{"start":10,"end":13,"tag":"go"}],"mentions":[{"start":0,"end":4,"username":"bob"}]},
+		"public_metrics":{"retweet_count":4,"reply_count":0,"like_count":1,"quote_count":0}},
+		"includes":{"users":[{"id":"10","name":"Alice","username":"alice","public_metrics":{"followers_count":5}}],
+		"media":[{"media_key":"3_1","type":"video","preview_image_url":"https://pbs.twimg.com/1.jpg"}],
+		"places":[{"id":"p1","full_name":"Itasca, IL","country_code":"US","geo":{"type":"Feature","bbox":[-88,41,-87,42]}}],
+		"tweets":[{"id":"1","text":"original","author_id":"12"}]}}`
+	var msg StreamResponseV2
+	if err := json.Unmarshal([]byte(line), &msg); err != nil {
+		t.Fatal(err)
+	}
+	nt := msg.Normalize()
+	if nt.ID != "3" || nt.APIVersion != 2 || nt.Author.Username != "alice" || nt.Author.FollowersCount != 5 || nt.RetweetCount != 4 {
+		t.Errorf("unexpected tweet %+v", nt)
+	}
+	if want := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC); !nt.CreatedAt.Equal(want) {
+		t.Errorf("expected %v got %v", want, nt.CreatedAt)
+	}
+	if !reflect.DeepEqual(nt.Mentions, []string{"bob"}) || !reflect.DeepEqual(nt.Hashtags, []string{"go"}) || nt.InReplyToUserID != "11" {
+		t.Errorf("unexpected entities %+v", nt)
+	}
+	if len(nt.Media) != 1 || nt.Media[0].Type != "video" || nt.Media[0].URL != "https://pbs.twimg.com/1.jpg" {
+		t.Errorf("unexpected media %+v", nt.Media)
+	}
+	if nt.Geo == nil || nt.Geo.Precision != PrecisionPlace || nt.Geo.Point != (Point{-87.5, 41.5}) || nt.Geo.CountryCode != "US" {
+		t.Errorf("unexpected geo %+v", nt.Geo)
+	}
+	if reply := nt.Ref(RefRepliedTo); reply == nil || reply.ID != "2" || reply.Tweet != nil {
+		t.Errorf("expected a reply to 2 got %+v", reply)
+	}
+	if quoted := nt.Ref(RefQuoted); quoted == nil || quoted.Tweet == nil || quoted.Tweet.Text != "original" {
+		t.Errorf("expected the quoted tweet got %+v", quoted)
+	}
+
+	// both versions store the same way
+	b, err := json.Marshal(nt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back NormalizedTweet
+	if err = json.Unmarshal(b, &back); err != nil || !reflect.DeepEqual(&back, nt) {
+		t.Errorf("expected a round trip got %+v %v", back, err)
+	}
+	if (&StreamResponseV2{}).Normalize() != nil {
+		t.Error("expected nil for a message without a tweet")
+	}
+}
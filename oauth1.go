@@ -0,0 +1,169 @@
+package httpstream
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OAuth 1.0a HMAC-SHA1 request signing, RFC 5849
+// http://tools.ietf.org/html/rfc5849
+
+type oauth1 struct {
+	consumerKey, consumerSecret string
+	token, tokenSecret          string
+}
+
+// OAuth1 signs requests with OAuth 1.0a (HMAC-SHA1), for a twitter app's
+// consumer key and secret and a user's access token and secret.
+func OAuth1(consumerKey, consumerSecret, token, tokenSecret string) Authenticator {
+	return oauth1{consumerKey, consumerSecret, token, tokenSecret}
+}
+
+func (a oauth1) Authenticate(req *http.Request) error {
+	return a.sign(req, oauthNonce(), time.Now().Unix())
+}
+
+func (a oauth1) sign(req *http.Request, nonce string, timestamp int64) error {
+	oauthParams := url.Values{
+		"oauth_consumer_key":     {a.consumerKey},
+		"oauth_nonce":            {nonce},
+		"oauth_signature_method": {"HMAC-SHA1"},
+		"oauth_timestamp":        {strconv.FormatInt(timestamp, 10)},
+		"oauth_version":          {"1.0"},
+	}
+	if a.token != "" {
+		oauthParams.Set("oauth_token", a.token)
+	}
+	params, err := requestParams(req)
+	if err != nil {
+		return err
+	}
+	for k, v := range oauthParams {
+		params[k] = append(params[k], v...)
+	}
+	base := signatureBase(req.Method, req.URL, params)
+	oauthParams.Set("oauth_signature", hmacSign(a.consumerSecret, a.tokenSecret, base))
+	req.Header.Set("Authorization", oauthHeader(oauthParams))
+	return nil
+}
+
+// the query and form body params of a request, which are signed
+func requestParams(req *http.Request) (url.Values, error) {
+	params := req.URL.Query()
+	if req.Body == nil {
+		return params, nil
+	}
+	if ct, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); ct != "application/x-www-form-urlencoded" {
+		return params, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range form {
+		params[k] = append(params[k], v...)
+	}
+	return params, nil
+}
+
+// signatureBase builds the signature base string, RFC 5849 3.4.1
+func signatureBase(method string, u *url.URL, params url.Values) string {
+	pairs := make([][2]string, 0, len(params))
+	for k, values := range params {
+		for _, v := range values {
+			pairs = append(pairs, [2]string{percentEncode(k), percentEncode(v)})
+		}
+	}
+	sort.Sort(byKeyValue(pairs))
+	encoded := make([]string, len(pairs))
+	for i, kv := range pairs {
+		encoded[i] = kv[0] + "=" + kv[1]
+	}
+	return strings.ToUpper(method) + "&" + percentEncode(baseURI(u)) + "&" + percentEncode(strings.Join(encoded, "&"))
+}
+
+type byKeyValue [][2]string
+
+func (p byKeyValue) Len() int      { return len(p) }
+func (p byKeyValue) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p byKeyValue) Less(i, j int) bool {
+	if p[i][0] != p[j][0] {
+		return p[i][0] < p[j][0]
+	}
+	return p[i][1] < p[j][1]
+}
+
+// baseURI is the url without query, with the default port removed, 3.4.1.2
+func baseURI(u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Host)
+	if (scheme == "http" && strings.HasSuffix(host, ":80")) || (scheme == "https" && strings.HasSuffix(host, ":443")) {
+		host = host[:strings.LastIndex(host, ":")]
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	return scheme + "://" + host + path
+}
+
+func hmacSign(consumerSecret, tokenSecret, base string) string {
+	mac := hmac.New(sha1.New, []byte(percentEncode(consumerSecret)+"&"+percentEncode(tokenSecret)))
+	mac.Write([]byte(base))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func oauthHeader(oauthParams url.Values) string {
+	keys := make([]string, 0, len(oauthParams))
+	for k := range oauthParams {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = percentEncode(k) + `="` + percentEncode(oauthParams.Get(k)) + `"`
+	}
+	return "OAuth " + strings.Join(parts, ", ")
+}
+
+// percentEncode escapes all but the unreserved chars, 3.6
+func percentEncode(s string) string {
+	const hexChars = "0123456789ABCDEF"
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			buf.WriteByte(c)
+		} else {
+			buf.WriteByte('%')
+			buf.WriteByte(hexChars[c>>4])
+			buf.WriteByte(hexChars[c&15])
+		}
+	}
+	return buf.String()
+}
+
+func oauthNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,156 @@
+package httpstream
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/araddon/httpstream/httpstreamtest"
+)
+
+func TestSignatureBase(t *testing.T) {
+	// RFC 5849 3.4.1.1
+	req, _ := http.NewRequest("POST", "http://example.com/request?b5=%3D%253D&a3=a&c%40=&a2=r%20b", strings.NewReader("c2&a3=2+q"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	params, err := requestParams(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{
+		"oauth_consumer_key":     "9djdj82h48djs9d2",
+		"oauth_token":            "kkk9d7dh3k39sjv7",
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        "137131201",
+		"oauth_nonce":            "7d8f3e4a",
+	} {
+		params.Set(k, v)
+	}
+	want := "POST&http%3A%2F%2Fexample.com%2Frequest&a2%3Dr%2520b%26a3%3D2%2520q" +
+		"%26a3%3Da%26b5%3D%253D%25253D%26c%2540%3D%26c2%3D%26oauth_consumer_" +
+		"key%3D9djdj82h48djs9d2%26oauth_nonce%3D7d8f3e4a%26oauth_signature_m" +
+		"ethod%3DHMAC-SHA1%26oauth_timestamp%3D137131201%26oauth_token%3Dkkk" +
+		"9d7dh3k39sjv7"
+	if got := signatureBase(req.Method, req.URL, params); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+	if body, _ := ioutil.ReadAll(req.Body); string(body) != "c2&a3=2+q" {
+		t.Errorf("expected the body to be kept got %q", body)
+	}
+
+	for raw, want := range map[string]string{
+		"HTTP://Example.com:80/r%20v/X?id=123": "http://example.com/r%20v/X",
+		"https://www.example.net:8080/?q=1":    "https://www.example.net:8080/",
+		"https://api.twitter.com:443":          "https://api.twitter.com/",
+	} {
+		u, _ := url.Parse(raw)
+		if got := baseURI(u); got != want {
+			t.Errorf("%s expected %s got %s", raw, want, got)
+		}
+	}
+}
+
+func TestOAuth1Signature(t *testing.T) {
+	for _, test := range []struct {
+		method, url, body         string
+		auth                      oauth1
+		nonce, timestamp, version string
+		signature                 string
+	}{
+		// RFC 5849 1.2, which has no oauth_version
+		{"GET", "http://photos.example.net/photos?file=vacation.jpg&size=original", "",
+			oauth1{"dpf43f3p2l4k3l03", "kd94hf93k423kf44", "nnch734d00sl2jdk", "pfkkdhi9sl3r4s00"},
+			"chapoH", "137131202", "", "MdpQcU8iPSUjWoN/UDMsK2sui9I="},
+		// OAuth Core 1.0 appendix A.5
+		{"GET", "http://photos.example.net/photos?file=vacation.jpg&size=original", "",
+			oauth1{"dpf43f3p2l4k3l03", "kd94hf93k423kf44", "nnch734d00sl2jdk", "pfkkdhi9sl3r4s00"},
+			"kllo9940pd9333jh", "1191242096", "1.0", "tR3+Ty81lMeYAr/Fid0kMTYa/WM="},
+		// twitter's "creating a signature" example
+		{"POST", "https://api.twitter.com/1.1/statuses/update.json?include_entities=true",
+			"status=Hello%20Ladies%20%2b%20Gentlemen%2c%20a%20signed%20OAuth%20request%21",
+			oauth1{"xvz1evFS4wEEPTGEFPHBog", "kAcSOqF21Fu85e7zjz7ZN2U4ZRhfV3WpwPAoE3Z7kBw",
+				"370773112-GmHxMAgYyLbNEtIKZeRNFsMKPR9EyMZeS9weJAEb", "LswwdoUaIvS8ltyTt5jkRh4J50vUPVVHtR2YPi5kE"},
+			"kYjzVBB8Y0ZFabxSWbWovY3uYSQ2pTgmZeNu2VS4cg", "1318622958", "1.0", "hCtSmYh+iHYCEqBWrE7C7hYmtUk="},
+	} {
+		req, _ := http.NewRequest(test.method, test.url, strings.NewReader(test.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		params, _ := requestParams(req)
+		params.Set("oauth_consumer_key", test.auth.consumerKey)
+		params.Set("oauth_token", test.auth.token)
+		params.Set("oauth_signature_method", "HMAC-SHA1")
+		params.Set("oauth_timestamp", test.timestamp)
+		params.Set("oauth_nonce", test.nonce)
+		if test.version != "" {
+			params.Set("oauth_version", test.version)
+		}
+		base := signatureBase(req.Method, req.URL, params)
+		if got := hmacSign(test.auth.consumerSecret, test.auth.tokenSecret, base); got != test.signature {
+			t.Errorf("%s expected %s got %s", test.url, test.signature, got)
+		}
+	}
+
+	// and the same through sign, which adds the header
+	req, _ := http.NewRequest("GET", "http://photos.example.net/photos?file=vacation.jpg&size=original", nil)
+	auth := oauth1{"dpf43f3p2l4k3l03", "kd94hf93k423kf44", "nnch734d00sl2jdk", "pfkkdhi9sl3r4s00"}
+	if err := auth.sign(req, "kllo9940pd9333jh", 1191242096); err != nil {
+		t.Fatal(err)
+	}
+	want := `OAuth oauth_consumer_key="dpf43f3p2l4k3l03", oauth_nonce="kllo9940pd9333jh", ` +
+		`oauth_signature="tR3%2BTy81lMeYAr%2FFid0kMTYa%2FWM%3D", oauth_signature_method="HMAC-SHA1", ` +
+		`oauth_timestamp="1191242096", oauth_token="nnch734d00sl2jdk", oauth_version="1.0"`
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestOAuthClient(t *testing.T) {
+	srv := httpstreamtest.NewServer(httpstreamtest.Script{
+		httpstreamtest.Message(`{"id_str":"1","text":"one"}`),
+		httpstreamtest.Hold(),
+	})
+	defer srv.Close()
+	saved := filterURL
+	defer func() { filterURL = saved }()
+	filterURL, _ = url.Parse(srv.URL + "/1.1/statuses/filter.json")
+
+	lines := make(chan []byte, 10)
+	client := NewOAuthClient("ck", "cs", "ot", "os", func(line []byte) {
+		lines <- line
+	})
+	if err := client.Filter(nil, []string{"golang"}, nil, nil, false, make(chan bool, 1)); err != nil {
+		t.Fatal(err)
+	}
+	waitForLines(t, lines, 1)
+	client.Close()
+
+	reqs := srv.Requests()
+	if len(reqs) != 1 || reqs[0].Method != "POST" || reqs[0].Form.Get("track") != "golang" {
+		t.Fatalf("unexpected requests %v", reqs)
+	}
+	header := reqs[0].Header.Get("Authorization")
+	for _, want := range []string{"OAuth ", `oauth_consumer_key="ck"`, `oauth_token="ot"`, `oauth_signature_method="HMAC-SHA1"`} {
+		if !strings.Contains(header, want) {
+			t.Errorf("expected %s in %s", want, header)
+		}
+	}
+
+	// check the signature as the server would
+	params := url.Values{}
+	for k, v := range reqs[0].Form {
+		params[k] = v
+	}
+	var signature string
+	for _, part := range strings.Split(strings.TrimPrefix(header, "OAuth "), ", ") {
+		kv := strings.SplitN(part, "=", 2)
+		v, _ := url.QueryUnescape(strings.Trim(kv[1], `"`))
+		if kv[0] == "oauth_signature" {
+			signature = v
+		} else {
+			params.Set(kv[0], v)
+		}
+	}
+	if want := hmacSign("cs", "os", signatureBase("POST", filterURL, params)); signature != want {
+		t.Errorf("expected signature %s got %s", want, signature)
+	}
+}
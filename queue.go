@@ -0,0 +1,331 @@
+package httpstream
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// The default size of the queue between the stream reader and the Handler.
+const DefaultQueueSize = 1000
+
+var errSpillCorrupt = errors.New("corrupt spill file")
+
+// OverflowPolicy decides what happens to new messages when the queue between
+// the stream reader and the Handler is full.
+type OverflowPolicy int
+
+const (
+	// wait for the Handler to catch up, which stops reading from the
+	// stream (and twitter will eventually disconnect us)
+	Block OverflowPolicy = iota
+	// throw away the oldest queued message to make room
+	DropOldest
+	// throw away the new message
+	DropNewest
+	// write messages to a file until the Handler catches up
+	SpillToDisk
+)
+
+// QueueStats are counters for the queue between the stream reader and the
+// Handler.
+type QueueStats struct {
+	// messages waiting to be handled, including any on disk
+	Depth int
+	// of Depth, the messages spilled to disk
+	Spilled int
+	// messages thrown away because the queue was full
+	Dropped int64
+	// messages handed to the Handler
+	Handled int64
+}
+
+// msgQueue is a bounded fifo of messages, with a single consumer goroutine
+// that runs the handler.
+type msgQueue struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	idle     *sync.Cond
+	// messages popped but not yet handled
+	busy     int
+	buf      [][]byte
+	head     int
+	n        int
+	policy   OverflowPolicy
+	spillDir string
+	spill    *spillFile
+	// no more messages are accepted
+	closed bool
+	// the queued messages have been thrown away, see Close
+	stopped bool
+	dropped int64
+	handled int64
+	done    chan bool
+}
+
+func newMsgQueue(size int, policy OverflowPolicy, spillDir string) *msgQueue {
+	q := &msgQueue{
+		buf:      make([][]byte, size),
+		policy:   policy,
+		spillDir: spillDir,
+		done:     make(chan bool),
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	q.idle = sync.NewCond(&q.mu)
+	return q
+}
+
+// Push adds a message, applying the overflow policy if full.
+func (q *msgQueue) Push(line []byte) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.policy == SpillToDisk && q.spill != nil && q.spill.count > 0 {
+		// keep order, everything goes to disk until it has been drained
+		q.spillLine(line)
+		return
+	}
+	for q.n == len(q.buf) && !q.closed {
+		switch q.policy {
+		case DropOldest:
+			q.buf[q.head] = nil
+			q.head = (q.head + 1) % len(q.buf)
+			q.n--
+			q.dropped++
+		case DropNewest:
+			q.dropped++
+			return
+		case SpillToDisk:
+			q.spillLine(line)
+			return
+		default:
+			q.notFull.Wait()
+		}
+	}
+	if q.closed {
+		q.dropped++
+		return
+	}
+	q.buf[(q.head+q.n)%len(q.buf)] = line
+	q.n++
+	q.notEmpty.Signal()
+}
+
+// must hold the lock
+func (q *msgQueue) spillLine(line []byte) {
+	if q.spill == nil {
+		spill, err := newSpillFile(q.spillDir)
+		if err != nil {
+			Log(ERROR, "could not create spill file, dropping message ", err)
+			q.dropped++
+			return
+		}
+		q.spill = spill
+	}
+	if err := q.spill.write(line); err != nil {
+		Log(ERROR, "could not write to spill file, dropping message ", err)
+		q.dropped++
+		return
+	}
+	q.notEmpty.Signal()
+}
+
+// Pop waits for the next message, ok is false once the queue is closed
+// and empty.
+func (q *msgQueue) Pop() (line []byte, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if q.n == 0 && q.spill != nil && q.spill.count > 0 {
+			q.refill()
+		}
+		if q.n > 0 {
+			break
+		}
+		if q.closed {
+			return nil, false
+		}
+		q.notEmpty.Wait()
+	}
+	line = q.buf[q.head]
+	q.buf[q.head] = nil
+	q.head = (q.head + 1) % len(q.buf)
+	q.n--
+	q.handled++
+	q.busy++
+	q.notFull.Signal()
+	return line, true
+}
+
+// move spilled messages back into memory, must hold the lock
+func (q *msgQueue) refill() {
+	for q.n < len(q.buf) && q.spill.count > 0 {
+		line, err := q.spill.read()
+		if err != nil {
+			Log(ERROR, "could not read spill file, dropping ", q.spill.count, " messages ", err)
+			q.dropped += int64(q.spill.count)
+			q.spill.reset()
+			return
+		}
+		q.buf[(q.head+q.n)%len(q.buf)] = line
+		q.n++
+	}
+	if q.spill.count == 0 {
+		q.spill.reset()
+	}
+}
+
+// run the handler on each message until closed
+func (q *msgQueue) run(handler func([]byte)) {
+	for {
+		line, ok := q.Pop()
+		if !ok {
+			break
+		}
+		handler(line)
+		q.mu.Lock()
+		q.busy--
+		q.idle.Broadcast()
+		q.mu.Unlock()
+	}
+	q.mu.Lock()
+	q.removeSpill()
+	q.mu.Unlock()
+	close(q.done)
+}
+
+// Drain stops accepting messages, and waits up to timeout (0 for as long as
+// it takes) for the queued ones to be handled, returning false if they
+// weren't.
+func (q *msgQueue) Drain(timeout time.Duration) bool {
+	q.mu.Lock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+	q.mu.Unlock()
+	if timeout <= 0 {
+		<-q.done
+		return true
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-q.done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Close stops accepting messages and throws away the queued ones, without
+// waiting for the Handler, which may be blocked.
+func (q *msgQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.stopped = true
+	q.dropped += int64(q.n)
+	if q.spill != nil {
+		q.dropped += int64(q.spill.count)
+	}
+	for i := range q.buf {
+		q.buf[i] = nil
+	}
+	q.head, q.n = 0, 0
+	q.removeSpill()
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+	q.idle.Broadcast()
+}
+
+// must hold the lock
+func (q *msgQueue) removeSpill() {
+	if q.spill != nil {
+		q.spill.remove()
+		q.spill = nil
+	}
+}
+
+// Wait until every queued message has been handled, or the queue is closed.
+func (q *msgQueue) Wait() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.stopped && (q.n > 0 || q.busy > 0 || (q.spill != nil && q.spill.count > 0)) {
+		q.idle.Wait()
+	}
+}
+
+func (q *msgQueue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := QueueStats{Depth: q.n, Dropped: q.dropped, Handled: q.handled}
+	if q.spill != nil {
+		stats.Spilled = q.spill.count
+		stats.Depth += q.spill.count
+	}
+	return stats
+}
+
+// spillFile is an append only file of length prefixed messages, read from the
+// front, and truncated whenever it has been fully read.
+type spillFile struct {
+	f        *os.File
+	readOff  int64
+	writeOff int64
+	count    int
+}
+
+func newSpillFile(dir string) (*spillFile, error) {
+	f, err := ioutil.TempFile(dir, "httpstream-spill")
+	if err != nil {
+		return nil, err
+	}
+	return &spillFile{f: f}, nil
+}
+
+func (s *spillFile) write(line []byte) error {
+	var hdr [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(hdr[:], uint64(len(line)))
+	if _, err := s.f.WriteAt(hdr[:n], s.writeOff); err != nil {
+		return err
+	}
+	if _, err := s.f.WriteAt(line, s.writeOff+int64(n)); err != nil {
+		return err
+	}
+	s.writeOff += int64(n + len(line))
+	s.count++
+	return nil
+}
+
+func (s *spillFile) read() ([]byte, error) {
+	var hdr [binary.MaxVarintLen64]byte
+	n, err := s.f.ReadAt(hdr[:], s.readOff)
+	if n == 0 {
+		return nil, err
+	}
+	size, hn := binary.Uvarint(hdr[:n])
+	if hn <= 0 {
+		return nil, errSpillCorrupt
+	}
+	line := make([]byte, size)
+	if _, err := s.f.ReadAt(line, s.readOff+int64(hn)); err != nil {
+		return nil, err
+	}
+	s.readOff += int64(hn) + int64(size)
+	s.count--
+	return line, nil
+}
+
+func (s *spillFile) reset() {
+	s.readOff, s.writeOff, s.count = 0, 0, 0
+	s.f.Truncate(0)
+}
+
+func (s *spillFile) remove() {
+	s.f.Close()
+	os.Remove(s.f.Name())
+}
@@ -0,0 +1,104 @@
+package httpstream
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// push n numbered messages into a full (unconsumed) queue, then drain it
+func fillQueue(q *msgQueue, n int) []string {
+	for i := 0; i < n; i++ {
+		q.Push([]byte(strconv.Itoa(i)))
+	}
+	got := make([]string, 0)
+	go q.run(func(line []byte) {
+		got = append(got, string(line))
+	})
+	q.Drain(0)
+	return got
+}
+
+func TestQueueOverflow(t *testing.T) {
+	q := newMsgQueue(3, DropOldest, "")
+	if got := fillQueue(q, 5); len(got) != 3 || got[0] != "2" || got[2] != "4" {
+		t.Errorf("expected the newest 3 got %v", got)
+	}
+	if stats := q.Stats(); stats.Dropped != 2 || stats.Handled != 3 || stats.Depth != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	q = newMsgQueue(3, DropNewest, "")
+	if got := fillQueue(q, 5); len(got) != 3 || got[0] != "0" || got[2] != "2" {
+		t.Errorf("expected the oldest 3 got %v", got)
+	}
+
+	q = newMsgQueue(3, SpillToDisk, t.TempDir())
+	for i := 0; i < 10; i++ {
+		q.Push([]byte(strconv.Itoa(i)))
+	}
+	if stats := q.Stats(); stats.Depth != 10 || stats.Spilled != 7 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	got := fillQueue(q, 0)
+	if len(got) != 10 {
+		t.Fatalf("expected all 10 messages got %v", got)
+	}
+	for i, line := range got {
+		if line != strconv.Itoa(i) {
+			t.Errorf("expected messages in order got %v", got)
+			break
+		}
+	}
+}
+
+func TestQueueBlock(t *testing.T) {
+	q := newMsgQueue(1, Block, "")
+	handled := make(chan string, 10)
+	go q.run(func(line []byte) {
+		handled <- string(line)
+	})
+	for i := 0; i < 5; i++ {
+		q.Push([]byte(strconv.Itoa(i)))
+	}
+	q.Drain(0)
+	if len(handled) != 5 || q.Stats().Dropped != 0 {
+		t.Errorf("expected all 5 handled got %d", len(handled))
+	}
+}
+
+func TestQueueClose(t *testing.T) {
+	q := newMsgQueue(10, Block, "")
+	block := make(chan bool)
+	handled := make(chan string, 10)
+	go q.run(func(line []byte) {
+		handled <- string(line)
+		<-block
+	})
+	for i := 0; i < 5; i++ {
+		q.Push([]byte(strconv.Itoa(i)))
+	}
+	<-handled
+	// the handler is stuck on the first message
+	if q.Drain(50 * time.Millisecond) {
+		t.Error("expected the drain to time out")
+	}
+	closed := make(chan bool)
+	go func() {
+		q.Close()
+		closed <- true
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Close not to wait for a blocked handler")
+	}
+	if stats := q.Stats(); stats.Dropped != 4 || stats.Depth != 0 {
+		t.Errorf("expected the queued messages dropped got %+v", stats)
+	}
+	close(block)
+	<-q.done
+	if len(handled) != 0 {
+		t.Errorf("expected nothing handled after Close got %d", len(handled))
+	}
+}
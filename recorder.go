@@ -0,0 +1,289 @@
+package httpstream
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SyncPolicy is how often the Recorder fsyncs its files
+type SyncPolicy int
+
+const (
+	// leave it to the os
+	SyncNone SyncPolicy = iota
+	// when a file is rotated or closed
+	SyncRotate
+	// after every message, slow but nothing is lost on a crash
+	SyncEvery
+)
+
+// RecorderConfig configures a Recorder, zero values are no limit.
+type RecorderConfig struct {
+	// directory to write to, created if need be
+	Dir string
+	// file name prefix, "stream" if empty
+	Prefix string
+	// rotate to a new file after this many (uncompressed) bytes
+	MaxBytes int64
+	// rotate to a new file after this long
+	MaxAge time.Duration
+	// gzip the files
+	Gzip bool
+	Sync SyncPolicy
+}
+
+// RecordedMessage is one line of a recording, the raw message and when it
+// was received.  Messages that are not valid json (or not on one line) are
+// kept as a string in Raw.
+type RecordedMessage struct {
+	Received time.Time       `json:"received"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	Raw      string          `json:"raw,omitempty"`
+}
+
+// RecordedFile is a manifest entry, describing one file of a recording.
+type RecordedFile struct {
+	Name     string    `json:"name"`
+	First    time.Time `json:"first"`
+	Last     time.Time `json:"last"`
+	Messages int64     `json:"messages"`
+	Bytes    int64     `json:"bytes"`
+}
+
+// Recorder is a handler that writes every message to rotating ndjson files
+// of RecordedMessage, optionally gzipped, and keeps a manifest of the files
+// and the time range they cover in <prefix>-manifest.json.
+//
+//	rec, err := httpstream.NewRecorder(httpstream.RecorderConfig{Dir: "capture", MaxAge: time.Hour, Gzip: true})
+//	client.Record(rec)
+type Recorder struct {
+	cfg      RecorderConfig
+	mu       sync.Mutex
+	file     *os.File
+	buf      *bufio.Writer
+	gz       *gzip.Writer
+	w        io.Writer
+	current  *RecordedFile
+	opened   time.Time
+	manifest []RecordedFile
+}
+
+func NewRecorder(cfg RecorderConfig) (*Recorder, error) {
+	if cfg.Prefix == "" {
+		cfg.Prefix = "stream"
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+	r := &Recorder{cfg: cfg}
+	// carry on an existing manifest
+	if data, err := ioutil.ReadFile(r.manifestPath()); err == nil {
+		if err = json.Unmarshal(data, &r.manifest); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *Recorder) manifestPath() string {
+	return filepath.Join(r.cfg.Dir, r.cfg.Prefix+"-manifest.json")
+}
+
+// Handle records a message, received now.
+func (r *Recorder) Handle(line []byte) {
+	if err := r.Record(line, time.Now()); err != nil {
+		Log(ERROR, "could not record message ", err)
+	}
+}
+
+// Record records every message the client reads, with the time it was read
+// (see OnReceive), and closes rec when the client is closed.
+func (c *Client) Record(rec *Recorder) {
+	c.OnReceive(func(line []byte, received time.Time) {
+		if err := rec.Record(line, received); err != nil {
+			Log(ERROR, "could not record message ", err)
+		}
+	})
+	c.OnClose(rec.Close)
+}
+
+// Middleware records each message, and passes it on.  The time recorded is
+// when the message was handled, which is after the queue, so under
+// backpressure it can be well after it was received and a Replay will not
+// have the stream's timing, use Client.Record for that.
+func (r *Recorder) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return func(line []byte) {
+			r.Handle(line)
+			next(line)
+		}
+	}
+}
+
+// Record writes a message with the time it was received.
+func (r *Recorder) Record(line []byte, received time.Time) error {
+	data, err := recordedMessage(line, received)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file != nil && r.full(received) {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	if r.file == nil {
+		if err := r.open(received); err != nil {
+			return err
+		}
+	}
+	if _, err := r.w.Write(data); err != nil {
+		return err
+	}
+	if r.current.Messages == 0 {
+		r.current.First = received
+	}
+	r.current.Last = received
+	r.current.Messages++
+	r.current.Bytes += int64(len(data))
+	if r.cfg.Sync == SyncEvery {
+		return r.flush(true)
+	}
+	return nil
+}
+
+// recordedMessage encodes a RecordedMessage line, with the message byte for
+// byte as it was received: json.Marshal would compact it and escape html.
+// Json on more than one line can't go in ndjson as is, so goes in Raw.
+func recordedMessage(line []byte, received time.Time) ([]byte, error) {
+	ts, err := received.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`{"received":`)
+	buf.Write(ts)
+	if bytes.IndexAny(line, "\r\n") < 0 && json.Valid(line) {
+		buf.WriteString(`,"data":`)
+		buf.Write(line)
+	} else {
+		buf.WriteString(`,"raw":`)
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err = enc.Encode(string(line)); err != nil {
+			return nil, err
+		}
+		buf.Truncate(buf.Len() - 1)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+// whether the current file should be rotated, must hold the lock
+func (r *Recorder) full(now time.Time) bool {
+	return (r.cfg.MaxBytes > 0 && r.current.Bytes >= r.cfg.MaxBytes) ||
+		(r.cfg.MaxAge > 0 && now.Sub(r.opened) >= r.cfg.MaxAge)
+}
+
+func (r *Recorder) open(now time.Time) error {
+	name := r.cfg.Prefix + "-" + now.UTC().Format("20060102T150405.000000000") + ".ndjson"
+	if r.cfg.Gzip {
+		name += ".gz"
+	}
+	f, err := os.OpenFile(filepath.Join(r.cfg.Dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	r.file, r.opened = f, now
+	r.buf = bufio.NewWriter(f)
+	r.w = r.buf
+	if r.cfg.Gzip {
+		r.gz = gzip.NewWriter(r.buf)
+		r.w = r.gz
+	}
+	r.current = &RecordedFile{Name: name}
+	return nil
+}
+
+// flush buffered data to the file, and optionally fsync
+func (r *Recorder) flush(sync bool) error {
+	if r.gz != nil {
+		if err := r.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	if err := r.buf.Flush(); err != nil {
+		return err
+	}
+	if sync {
+		return r.file.Sync()
+	}
+	return nil
+}
+
+// close the current file and add it to the manifest, must hold the lock
+func (r *Recorder) rotate() error {
+	if r.file == nil {
+		return nil
+	}
+	var err error
+	if r.gz != nil {
+		err = r.gz.Close()
+		r.gz = nil
+	}
+	if ferr := r.flush(r.cfg.Sync != SyncNone); err == nil {
+		err = ferr
+	}
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.file = nil
+	r.manifest = append(r.manifest, *r.current)
+	if merr := r.writeManifest(); err == nil {
+		err = merr
+	}
+	return err
+}
+
+func (r *Recorder) writeManifest() error {
+	data, err := json.MarshalIndent(r.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := r.manifestPath() + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.manifestPath())
+}
+
+// Manifest returns the files written so far, not including the current one.
+func (r *Recorder) Manifest() []RecordedFile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedFile(nil), r.manifest...)
+}
+
+// Rotate closes the current file, the next message starts a new one.
+func (r *Recorder) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rotate()
+}
+
+// Close closes the current file and writes the manifest.
+func (r *Recorder) Close() {
+	if err := r.Rotate(); err != nil {
+		Log(ERROR, "error closing recorder ", err)
+	}
+}
@@ -0,0 +1,132 @@
+package httpstream
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/araddon/httpstream/httpstreamtest"
+)
+
+func TestRecorder(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := NewRecorder(RecorderConfig{Dir: dir, MaxBytes: 1000, Gzip: true, Sync: SyncRotate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	rec.Record([]byte(`not json`), start)
+	for i, tw := range tweets {
+		rec.Record([]byte(tw), start.Add(time.Duration(i+1)*time.Second))
+	}
+	rec.Close()
+
+	manifest := rec.Manifest()
+	if len(manifest) < 2 {
+		t.Fatalf("expected the recording to rotate got %v", manifest)
+	}
+	if !manifest[0].First.Equal(start) || !manifest[len(manifest)-1].Last.Equal(start.Add(time.Duration(len(tweets))*time.Second)) {
+		t.Errorf("unexpected time range %v", manifest)
+	}
+
+	msgs := make([]RecordedMessage, 0)
+	for _, file := range manifest {
+		f, err := os.Open(filepath.Join(dir, file.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(gz)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var msg RecordedMessage
+			if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+				t.Fatal(err)
+			}
+			msgs = append(msgs, msg)
+		}
+		f.Close()
+	}
+	// the fixtures are over several lines, so are kept as is in Raw
+	if len(msgs) != len(tweets)+1 || msgs[0].Raw != "not json" || msgs[1].Raw != tweets[0] {
+		t.Errorf("unexpected recording %d messages", len(msgs))
+	}
+
+	// a new recorder carries on the manifest
+	rec, _ = NewRecorder(RecorderConfig{Dir: dir, Gzip: true})
+	rec.Handle([]byte(`{}`))
+	rec.Close()
+	if len(rec.Manifest()) != len(manifest)+1 {
+		t.Errorf("expected manifest to be appended to")
+	}
+}
+
+func TestRecorderVerbatim(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := NewRecorder(RecorderConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := `{"text": "a <b> & c",  "id_str":"1"}`
+	received := time.Date(2012, 8, 10, 1, 2, 3, 0, time.UTC)
+	rec.Record([]byte(line), received)
+	rec.Close()
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, rec.Manifest()[0].Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"received":"2012-08-10T01:02:03Z","data":` + line + "}\n"; string(data) != want {
+		t.Errorf("expected the message byte for byte got %s", data)
+	}
+	if got, ts := recordedLine(json.RawMessage(data)); string(got) != line || !ts.Equal(received) {
+		t.Errorf("expected replay to deliver it as received got %s %v", got, ts)
+	}
+}
+
+func TestClientRecord(t *testing.T) {
+	srv := httpstreamtest.NewServer(httpstreamtest.Script{
+		httpstreamtest.Message(`{"id_str":"1","text":"one"}`),
+		httpstreamtest.Message(`{"id_str":"2","text":"two"}`),
+		httpstreamtest.Hold(),
+	})
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	dir := t.TempDir()
+	rec, err := NewRecorder(RecorderConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handled := make(chan time.Time, 2)
+	client := NewClient(func(line []byte) {
+		// a slow handler, the messages queue up
+		time.Sleep(50 * time.Millisecond)
+		handled <- time.Now()
+	})
+	client.Record(rec)
+	if err := client.Connect(u, nil, make(chan bool, 1)); err != nil {
+		t.Fatal(err)
+	}
+	<-handled
+	last := <-handled
+	client.Close()
+
+	manifest := rec.Manifest()
+	if len(manifest) != 1 || manifest[0].Messages != 2 {
+		t.Fatalf("expected 2 messages recorded got %v", manifest)
+	}
+	// stamped as read, not as handled
+	if !manifest[0].Last.Before(last.Add(-40 * time.Millisecond)) {
+		t.Errorf("expected the receive time %v well before it was handled %v", manifest[0].Last, last)
+	}
+}
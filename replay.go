@@ -0,0 +1,182 @@
+package httpstream
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RecordedFiles returns the files of a Recorder's recording, oldest first,
+// from its manifest.
+func RecordedFiles(dir, prefix string) ([]string, error) {
+	if prefix == "" {
+		prefix = "stream"
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, prefix+"-manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	var manifest []RecordedFile
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	files := make([]string, len(manifest))
+	for i, f := range manifest {
+		files[i] = filepath.Join(dir, f.Name)
+	}
+	return files, nil
+}
+
+// Replay plays recorded messages through the client's pipeline (middleware,
+// queue and Handler) instead of connecting, for reproducible tests offline.
+// Files may be Recorder files (gzipped or not), or fixtures of json messages
+// such as data/testdata.json.
+// @speed  1 replays at the recorded pace, 2 twice as fast, 0 as fast as possible.
+// Fixtures have no timestamps so always play as fast as possible.
+// @done  is sent true when all messages have been handled
+//
+//	files, _ := httpstream.RecordedFiles("capture", "")
+//	client.Replay(1, done, files...)
+func (c *Client) Replay(speed float64, done chan bool, files ...string) error {
+	readers := make([]io.ReadCloser, 0, len(files))
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			for _, r := range readers {
+				r.Close()
+			}
+			return err
+		}
+		readers = append(readers, f)
+	}
+	r := &replayer{speed: speed, stop: make(chan bool)}
+	c.replay = r
+	deliver := c.deliverer()
+	// Close clears c.queue, so keep our own
+	queue := c.msgQueue()
+	go func() {
+		for _, rc := range readers {
+			if err := r.play(rc, deliver); err != nil {
+				Log(ERROR, "replay error ", err)
+			}
+			rc.Close()
+		}
+		if queue != nil {
+			queue.Wait()
+		}
+		done <- true
+	}()
+	return nil
+}
+
+type replayer struct {
+	speed float64
+	// closed by Stop
+	stop     chan bool
+	stopOnce sync.Once
+	// the first recorded time, and when we replayed it
+	base  time.Time
+	start time.Time
+}
+
+func (r *replayer) Stop() {
+	r.stopOnce.Do(func() { close(r.stop) })
+}
+
+func (r *replayer) stopped() bool {
+	select {
+	case <-r.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// play the messages in one file
+func (r *replayer) play(rc io.Reader, deliver func([]byte)) error {
+	br := bufio.NewReader(rc)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		br = bufio.NewReader(gz)
+	}
+	dec := json.NewDecoder(br)
+	for !r.stopped() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		line, received := recordedLine(raw)
+		if !received.IsZero() && !r.wait(received) {
+			return nil
+		}
+		deliver(line)
+	}
+	return nil
+}
+
+// recordedLine unwraps a RecordedMessage, or returns a fixture as is, on a
+// single line as it would arrive from the stream
+func recordedLine(raw json.RawMessage) ([]byte, time.Time) {
+	if jsonLookup(raw, "received") != nil && (jsonLookup(raw, "data") != nil || jsonLookup(raw, "raw") != nil) {
+		var msg RecordedMessage
+		if err := json.Unmarshal(raw, &msg); err == nil {
+			if msg.Data == nil {
+				return []byte(msg.Raw), msg.Received
+			}
+			// recorded as received, see Recorder, unless hand written
+			// over several lines
+			raw = msg.Data
+			if bytes.IndexAny(raw, "\r\n") < 0 {
+				return raw, msg.Received
+			}
+			var buf bytes.Buffer
+			if json.Compact(&buf, raw) == nil {
+				return buf.Bytes(), msg.Received
+			}
+			return raw, msg.Received
+		}
+	}
+	var buf bytes.Buffer
+	if json.Compact(&buf, raw) != nil {
+		return raw, time.Time{}
+	}
+	return buf.Bytes(), time.Time{}
+}
+
+// sleep until it is time to replay a message received at t, false if
+// stopped meanwhile
+func (r *replayer) wait(t time.Time) bool {
+	if r.speed <= 0 {
+		return true
+	}
+	if r.base.IsZero() {
+		r.base, r.start = t, time.Now()
+		return true
+	}
+	due := time.Duration(float64(t.Sub(r.base)) / r.speed)
+	wait := due - time.Since(r.start)
+	if wait <= 0 {
+		return true
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.stop:
+		return false
+	}
+}
@@ -0,0 +1,90 @@
+package httpstream
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplay(t *testing.T) {
+	// fixtures
+	handled := make([][]byte, 0)
+	c := NewClient(func(line []byte) {
+		handled = append(handled, line)
+	})
+	c.Use(OnlyTweets())
+	done := make(chan bool, 1)
+	if err := c.Replay(0, done, "data/testdata.json"); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if len(handled) != len(tweets)-1 {
+		t.Fatalf("expected %d tweets got %d", len(tweets)-1, len(handled))
+	}
+	for _, line := range handled {
+		for _, b := range line {
+			if b == '\n' {
+				t.Fatalf("expected messages compacted to one line %s", line)
+			}
+		}
+	}
+
+	// a recording, at 10x speed
+	dir := t.TempDir()
+	rec, _ := NewRecorder(RecorderConfig{Dir: dir, MaxBytes: 2000, Gzip: true})
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		rec.Record([]byte(`{"id_str":"1","text":"hi"}`), start.Add(time.Duration(i)*100*time.Millisecond))
+	}
+	rec.Record([]byte(`not json`), start.Add(time.Second))
+	rec.Close()
+	files, err := RecordedFiles(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handled = handled[:0]
+	c = NewClient(func(line []byte) {
+		handled = append(handled, line)
+	})
+	began := time.Now()
+	c.Replay(10, done, files...)
+	<-done
+	if elapsed := time.Since(began); elapsed < 90*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Errorf("expected replay to take 100ms took %v", elapsed)
+	}
+	if len(handled) != 6 || string(handled[0]) != `{"id_str":"1","text":"hi"}` || string(handled[5]) != "not json" {
+		t.Errorf("unexpected replay %q", handled)
+	}
+}
+
+func TestReplayClose(t *testing.T) {
+	// an hour between messages, at the recorded pace
+	dir := t.TempDir()
+	rec, _ := NewRecorder(RecorderConfig{Dir: dir})
+	start := time.Now()
+	rec.Record([]byte(`{"id_str":"1","text":"hi"}`), start)
+	rec.Record([]byte(`{"id_str":"2","text":"later"}`), start.Add(time.Hour))
+	rec.Close()
+	files, err := RecordedFiles(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handled := make(chan []byte, 10)
+	c := NewClient(func(line []byte) {
+		handled <- line
+	})
+	done := make(chan bool, 1)
+	if err = c.Replay(1, done, files...); err != nil {
+		t.Fatal(err)
+	}
+	<-handled
+	c.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Close to stop the replay")
+	}
+	if len(handled) != 0 {
+		t.Errorf("expected nothing replayed after Close got %d", len(handled))
+	}
+}
@@ -0,0 +1,91 @@
+package httpstream
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sampling randomly passes on the given fraction (0 to 1) of messages.
+func Sampling(rate float64) Middleware {
+	return Filtering(func(line []byte) bool {
+		return rand.Float64() < rate
+	})
+}
+
+// SampleByKey passes on the given fraction (0 to 1) of messages, chosen by
+// hashing the value at the dotted json path key, so that the same key is
+// always in or always out of the sample (across restarts and processes too).
+// Messages without the key are always passed on, whatever the rate, so on a
+// twitter stream deletes, limits and warnings still reach the handler (even
+// at rate 0), use SampleByKeyStrict to drop them.
+//
+//	// the same 10% of users, all their tweets
+//	client.Use(httpstream.SampleByKey(0.1, "user.id_str"))
+func SampleByKey(rate float64, key string) Middleware {
+	return sampleByKey(rate, key, true)
+}
+
+// SampleByKeyStrict is SampleByKey, but drops messages without the key.
+func SampleByKeyStrict(rate float64, key string) Middleware {
+	return sampleByKey(rate, key, false)
+}
+
+func sampleByKey(rate float64, key string, keyless bool) Middleware {
+	path := strings.Split(key, ".")
+	return Filtering(func(line []byte) bool {
+		val := jsonString(line, path...)
+		if val == "" {
+			return keyless
+		}
+		return inSample(val, rate)
+	})
+}
+
+// whether the hash of key falls in the bottom rate fraction of the hash space
+func inSample(key string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return float64(h.Sum64()) < rate*math.MaxUint64
+}
+
+// RateLimit passes on at most perSecond messages a second, with bursts of up
+// to burst, dropping the rest (a token bucket).  Use it to protect downstream
+// systems, rather than to sample, as which messages are dropped depends on
+// arrival times.
+func RateLimit(perSecond float64, burst int) Middleware {
+	if burst < 1 {
+		burst = 1
+	}
+	bucket := &tokenBucket{rate: perSecond, size: float64(burst), tokens: float64(burst), last: time.Now()}
+	return Filtering(func(line []byte) bool {
+		return bucket.take(time.Now())
+	})
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	size   float64
+	tokens float64
+	last   time.Time
+}
+
+// take a token if there is one
+func (b *tokenBucket) take(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.size, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,68 @@
+package httpstream
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSampleByKey(t *testing.T) {
+	kept := make(map[string]int)
+	h := Chain(func(line []byte) {
+		kept[jsonString(line, "user", "id_str")]++
+	}, SampleByKey(0.25, "user.id_str"))
+	for i := 0; i < 4000; i++ {
+		h([]byte(fmt.Sprintf(`{"id_str":"%d","user":{"id_str":"%d"}}`, i, i%400)))
+	}
+	// roughly 100 of the 400 users, and all 10 tweets of each
+	if len(kept) < 70 || len(kept) > 130 {
+		t.Errorf("expected about 100 users got %d", len(kept))
+	}
+	for user, n := range kept {
+		if n != 10 || !inSample(user, 0.25) {
+			t.Errorf("expected all tweets from sampled user %s got %d", user, n)
+		}
+	}
+	keyless := []string{`{"delete":{"status":{"id_str":"1"}}}`, `{"limit":{"track":10}}`, `{"warning":{"code":"FALLING_BEHIND"}}`}
+	n := 0
+	h = Chain(func(line []byte) { n++ }, SampleByKey(0, "user.id_str"))
+	for _, line := range keyless {
+		h([]byte(line))
+	}
+	if n != len(keyless) {
+		t.Errorf("messages without the key should pass even at rate 0, got %d", n)
+	}
+	n = 0
+	h = Chain(func(line []byte) { n++ }, SampleByKeyStrict(1, "user.id_str"))
+	for _, line := range keyless {
+		h([]byte(line))
+	}
+	h([]byte(`{"id_str":"1","user":{"id_str":"1"}}`))
+	if n != 1 {
+		t.Errorf("expected the strict sample to drop messages without the key, got %d", n)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	b := &tokenBucket{rate: 10, size: 5, tokens: 5, last: time.Now()}
+	now := b.last
+	n := 0
+	for i := 0; i < 20; i++ {
+		if b.take(now) {
+			n++
+		}
+	}
+	if n != 5 {
+		t.Errorf("expected a burst of 5 got %d", n)
+	}
+	// 10/sec, so 2 more after 200ms
+	now = now.Add(200 * time.Millisecond)
+	for i := 0; i < 20; i++ {
+		if b.take(now) {
+			n++
+		}
+	}
+	if n != 7 {
+		t.Errorf("expected 7 got %d", n)
+	}
+}
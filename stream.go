@@ -7,24 +7,31 @@ package httpstream
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
-	"github.com/mrjones/oauth"
-	"io/ioutil"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
 	filterURL, _     = url.Parse("https://stream.twitter.com/1.1/statuses/filter.json")
 	sampleURL, _     = url.Parse("https://stream.twitter.com/1.1/statuses/sample.json")
+	firehoseURL, _   = url.Parse("https://stream.twitter.com/1.1/statuses/firehose.json")
 	userURL, _       = url.Parse("https://userstream.twitter.com/2/user.json")
 	siteStreamURL, _ = url.Parse("https://sitestream.twitter.com/2b/site.json")
 	retryTimeout     = time.Second * 10
+	// the unit of reconnect wait times, tests shorten it
+	backoffUnit = time.Second
 
 	ErrStaleConnection = errors.New("stale connection")
 )
@@ -34,21 +41,33 @@ func init() {
 }
 
 type streamConn struct {
-	c           *Client
-	client      *http.Client
-	resp        *http.Response
-	url         *url.URL
-	accessToken *oauth.AccessToken
-	authData    string
-	postData    string
-	stale       bool
-	closed      bool
+	c      *Client
+	client *http.Client
+	resp   *http.Response
+	url    *url.URL
+	auth   Authenticator
+	// the encoded params of the current attempt, sent as a form if post
+	// else in the query
+	form string
+	post bool
+	// params sent on the initial connect only, ie the firehose count
+	initial map[string]string
+	// guards stale, closed and resp, which Close sets from another goroutine
+	mu     sync.Mutex
+	stale  bool
+	closed bool
 	// wait time before trying to reconnect, this will be
 	// exponentially moved up until reaching maxWait, when
 	// it will exit
 	wait    int
 	maxWait int
 	connect func() (*http.Response, error)
+	// connect attempts made, and message counts used to estimate
+	// how much was missed while disconnected
+	attempts    int
+	connectedAt time.Time
+	lastMessage time.Time
+	msgCount    int64
 }
 
 // NewStreamConn creates a new stream connection.
@@ -58,35 +77,43 @@ func NewStreamConn(max int) streamConn {
 
 // Connect will mark the connection as stale, and let the connect() handler close after a read.
 func (conn *streamConn) Close() {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	// the reading goroutine closes it again once it notices it is stale
+	if conn.closed {
+		return
+	}
 	conn.stale = true
 	conn.closed = true
 	if conn.resp != nil {
 		conn.resp.Body.Close()
 	}
+	if !conn.current() {
+		return
+	}
+	conn.metrics().disconnected()
+	conn.health(func(h *Health) {
+		h.State = StateClosed
+		h.ConnectedAt = time.Time{}
+	})
 }
 
-// Connect using basic auth.
-func (conn *streamConn) basicauthConnect() (resp *http.Response, err error) {
-	if conn.stale {
+func (conn *streamConn) isStale() bool {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	return conn.stale
+}
+
+// Connect, with the request authenticated by conn.auth, see doAuthenticated.
+func (conn *streamConn) httpConnect() (resp *http.Response, err error) {
+	if conn.isStale() {
 		err = ErrStaleConnection
 		return
 	}
 
-	conn.client = &http.Client{}
+	conn.client = &http.Client{Transport: conn.c.Transport}
 
-	req, _ := http.NewRequest("GET", conn.url.String(), nil)
-	if conn.authData != "" {
-		req.Header.Set("Authorization", conn.authData)
-	}
-
-	if conn.postData != "" {
-		req, _ = http.NewRequest("POST", conn.url.String(), bytes.NewBufferString(conn.postData))
-		req.ContentLength = int64(len(conn.postData))
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	}
-	Debug(req.Header)
-	Debug(conn.postData)
-	if resp, err = conn.client.Do(req); err != nil {
+	if resp, err = doAuthenticated(conn.client, conn.auth, conn.request); err != nil {
 		Log(ERROR, "Could not Connect to Stream: ", err)
 		return
 	}
@@ -99,35 +126,122 @@ func (conn *streamConn) basicauthConnect() (resp *http.Response, err error) {
 	return
 }
 
-// Connect using OAuth.
-func (conn *streamConn) oauthConnect(params map[string]string) (resp *http.Response, err error) {
-	if conn.stale {
-		err = ErrStaleConnection
-		return
+// the request for the next connect attempt, a POST if connected with params,
+// else a GET with any params a ParamsFunc adds in the query
+func (conn *streamConn) request() (*http.Request, error) {
+	Debug(conn.form)
+	if conn.post {
+		req, err := http.NewRequest("POST", conn.url.String(), bytes.NewBufferString(conn.form))
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = int64(len(conn.form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
 	}
-
-	if resp, err = conn.c.consumer.Post(conn.url.String(), params, conn.accessToken); err != nil {
-		if resp != nil && resp.Body != nil {
-			data, _ := ioutil.ReadAll(resp.Body)
-			Log(ERROR, err, " ", string(data))
-			resp.Body.Close()
-		} else {
-			Log(ERROR, err)
+	u := *conn.url
+	if conn.form != "" {
+		query := u.Query()
+		form, _ := url.ParseQuery(conn.form)
+		for k, v := range form {
+			query[k] = v
 		}
+		u.RawQuery = query.Encode()
+	}
+	return http.NewRequest("GET", u.String(), nil)
+}
 
-	} else {
-		Debugf("connected to %s \n\thttp status = %v", conn.url, resp.Status)
-		Debug(resp.Header)
-		for n, v := range resp.Header {
-			Debug(n, v[0])
+// params builds the params for the next connect attempt, giving the client's
+// ParamsFunc a chance to adjust them.
+func (conn *streamConn) params(base map[string]string) map[string]string {
+	info := ConnectInfo{Attempt: conn.attempts}
+	conn.attempts++
+	if info.Attempt == 0 && len(conn.initial) > 0 {
+		merged := make(map[string]string, len(base)+len(conn.initial))
+		for k, v := range base {
+			merged[k] = v
+		}
+		for k, v := range conn.initial {
+			merged[k] = v
 		}
+		base = merged
 	}
+	if conn.c == nil || conn.c.ParamsFunc == nil {
+		return base
+	}
+	if !conn.lastMessage.IsZero() {
+		info.Disconnected = time.Since(conn.lastMessage)
+		if elapsed := conn.lastMessage.Sub(conn.connectedAt).Seconds(); elapsed > 0 {
+			info.Rate = float64(conn.msgCount) / elapsed
+		}
+	}
+	params := make(map[string]string, len(base))
+	for k, v := range base {
+		params[k] = v
+	}
+	return conn.c.ParamsFunc(params, info)
+}
 
-	return
+// mark the start of a new connection
+func (conn *streamConn) connected(resp *http.Response) {
+	conn.mu.Lock()
+	conn.resp = resp
+	conn.mu.Unlock()
+	conn.connectedAt = time.Now()
+	conn.msgCount = 0
+	conn.metrics().connected()
+	conn.latency().Reset()
+	conn.health(func(h *Health) {
+		h.State = StateConnected
+		h.ConnectedAt = conn.connectedAt
+		h.Failures = 0
+		h.Error = ""
+	})
+}
+
+// whether conn is the client's current connection, one that has been
+// replaced by another Connect must leave the client's state alone
+func (conn *streamConn) current() bool {
+	if conn.c == nil {
+		return false
+	}
+	conn.c.connMu.Lock()
+	defer conn.c.connMu.Unlock()
+	return conn.c.conn == conn
+}
+
+// the client's metrics, nil if not instrumented
+func (conn *streamConn) metrics() *StreamMetrics {
+	if conn.c == nil {
+		return nil
+	}
+	return conn.c.metrics
+}
+
+// the client's latency tracker, nil if not tracking
+func (conn *streamConn) latency() *LatencyTracker {
+	if conn.c == nil {
+		return nil
+	}
+	return conn.c.latency
+}
+
+// update the client's Health
+// health updates are only made by the client's current connection, see current
+func (conn *streamConn) health(f func(h *Health)) {
+	if conn.current() {
+		conn.c.health.update(f)
+	}
+}
+
+func (conn *streamConn) healthFailed(err error) {
+	if conn.current() {
+		conn.c.health.failed(err)
+	}
 }
 
 func formString(params map[string]string) string {
-	var vals url.Values
+	vals := url.Values{}
 	for k, v := range params {
 		vals.Add(k, v)
 	}
@@ -138,45 +252,85 @@ func (conn *streamConn) readStream(resp *http.Response, handler func([]byte), un
 
 	var reader *bufio.Reader
 	reader = bufio.NewReader(resp.Body)
-	conn.resp = resp
+	conn.connected(resp)
+	metrics := conn.metrics()
+	latency := conn.latency()
+	// why we are reconnecting, "" while connected
+	cause := ""
+	// the trace of the current reconnect, see Tracer
+	var reconnectCtx context.Context
+	var endReconnect func(error)
 
 	for {
 		//we've been closed
-		if conn.stale {
+		if conn.isStale() {
 			conn.Close()
+			if endReconnect != nil {
+				endReconnect(ErrStaleConnection)
+			}
 			Debug("Connection closed, shutting down ")
 			break
 		}
 
 		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			metrics.received(len(line))
+		}
 
 		if err != nil {
 
-			if conn.stale {
+			if conn.isStale() {
 				Debug("conn stale, continue")
 				continue
 			}
-			time.Sleep(time.Second * time.Duration(conn.wait))
+			if cause == "" {
+				metrics.disconnected()
+				cause = CauseReadError
+				if err == io.EOF {
+					cause = CauseEOF
+				}
+				reconnectCtx, endReconnect = conn.reconnectSpan(cause)
+				conn.health(func(h *Health) {
+					h.State = StateReconnecting
+					h.ConnectedAt = time.Time{}
+				})
+			}
+			metrics.reconnecting(cause, backoffUnit*time.Duration(conn.wait))
+			time.Sleep(backoffUnit * time.Duration(conn.wait))
 			//try reconnecting, but exponentially back off until MaxWait is reached then exit?
-			resp, err := conn.connect()
+			resp, err := conn.tracedConnect(reconnectCtx)
 			if err != nil || resp == nil {
 				Log(ERROR, " Could not reconnect to source? sleeping and will retry ", err)
+				cause = CauseConnectError
+				if err == nil {
+					err = errors.New("no response")
+				}
+				conn.healthFailed(err)
 				if conn.wait < conn.maxWait {
 					conn.wait = conn.wait * 2
 				} else {
 					Log(ERROR, "exiting, max wait reached")
+					endReconnect(errors.New("max wait reached"))
+					conn.health(func(h *Health) { h.State = StateDisconnected })
 					done <- true
 					return
 				}
 				continue
 			}
 			if resp.StatusCode != 200 {
+				resp.Body.Close()
+				cause = CauseHTTPPrefix + strconv.Itoa(resp.StatusCode)
+				conn.healthFailed(errors.New("stream HTTP Error: " + resp.Status))
 				if conn.wait < conn.maxWait {
 					conn.wait = conn.wait * 2
 				}
 				continue
 			}
 
+			conn.connected(resp)
+			cause = ""
+			endReconnect(nil)
+			endReconnect = nil
 			reader = bufio.NewReader(resp.Body)
 			continue
 		} else if conn.wait != 1 {
@@ -187,10 +341,99 @@ func (conn *streamConn) readStream(resp *http.Response, handler func([]byte), un
 		if len(line) == 0 {
 			continue
 		}
+		conn.lastMessage = time.Now()
+		conn.msgCount++
+		conn.health(func(h *Health) { h.LastMessage = conn.lastMessage })
+		metrics.message(line)
+		latency.Observe(line, conn.lastMessage)
+		if conn.c != nil && conn.c.seen != nil && conn.c.seen.Duplicate(line) {
+			continue
+		}
+		if conn.c != nil {
+			for _, f := range conn.c.receivers {
+				f(line, conn.lastMessage)
+			}
+		}
 		handler(line)
 	}
 }
 
+// HandlerPanic is the error reported to Client.ErrorHandler when the
+// Handler panics on a line.
+type HandlerPanic struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (p *HandlerPanic) Error() string {
+	return fmt.Sprintf("handler panic: %v", p.Value)
+}
+
+// handle runs the handler, recovering from (and reporting) any panic so that
+// a bad message doesn't kill the stream.
+func (c *Client) handle(handler func([]byte), line []byte) {
+	safeHandle(handler, line, c.ErrorHandler)
+}
+
+func safeHandle(handler func([]byte), line []byte, onErr func(error, []byte)) {
+	defer func() {
+		if r := recover(); r != nil {
+			err := &HandlerPanic{Value: r, Stack: debug.Stack()}
+			Log(ERROR, err, "\n", string(err.Stack), "\n", string(line))
+			if onErr != nil {
+				onErr(err, line)
+			}
+		}
+	}()
+	handler(line)
+}
+
+// deliverer builds the pipeline of middleware and Handler for a connection,
+// and returns the func the stream reader hands each line to, which queues it
+// for the Handler goroutine, or if QueueSize is 0 runs the pipeline.
+func (c *Client) deliverer(extra ...Middleware) func([]byte) {
+	mw := append(extra, c.middleware...)
+	if c.TraceMessages && c.Tracer != nil {
+		mw = append([]Middleware{traceMessages(c.Tracer)}, mw...)
+	}
+	if c.metrics != nil {
+		mw = append([]Middleware{c.metrics.timing}, mw...)
+	}
+	handler := Chain(c.Handler, mw...)
+	if c.QueueSize <= 0 {
+		return func(line []byte) {
+			c.handle(handler, line)
+		}
+	}
+	c.pipeline.Store(handler)
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+	if c.queue == nil {
+		c.queue = newMsgQueue(c.QueueSize, c.Overflow, c.SpillDir)
+		go c.queue.run(func(line []byte) {
+			c.handle(c.pipeline.Load().(Handler), line)
+		})
+	}
+	return c.queue.Push
+}
+
+// the queue between the stream reader and the Handler, nil if there is none
+func (c *Client) msgQueue() *msgQueue {
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+	return c.queue
+}
+
+// QueueStats returns the counters for the queue between the stream reader
+// and the Handler.
+func (c *Client) QueueStats() QueueStats {
+	q := c.msgQueue()
+	if q == nil {
+		return QueueStats{}
+	}
+	return q.Stats()
+}
+
 func encodedAuth(user, pwd string) string {
 	var buf bytes.Buffer
 	encoder := base64.NewEncoder(base64.StdEncoding, &buf)
@@ -204,46 +447,100 @@ type Client struct {
 	Username string
 	Password string
 	// unique id for this connection
-	Uniqueid    string
-	conn        *streamConn
-	consumer    *oauth.Consumer
-	MaxWait     int
-	accessToken *oauth.AccessToken
-	Handler     func([]byte)
+	Uniqueid string
+	conn     *streamConn
+	// guards conn, which the reading goroutine checks, see current
+	connMu     sync.Mutex
+	MaxWait    int
+	Handler    Handler
+	middleware []Middleware
+	// the pipeline the queue runs, for the current connection
+	pipeline atomic.Value
+	// optional, called before each connect/reconnect to set the params
+	// for that attempt, see BackfillParams
+	ParamsFunc ParamsFunc
+	// recently seen tweet ids, set by Backfill
+	seen *Deduper
+	// optional, called with the error and line when the Handler panics,
+	// and for the errors sent on a v2 stream (as ErrorsV2)
+	ErrorHandler func(err error, line []byte)
+	// size of the queue between reading the stream and the Handler, which
+	// runs on its own goroutine so a slow Handler doesn't stall the reads.
+	// 0 runs the Handler on the reading goroutine.
+	QueueSize int
+	// what to do with messages when the queue is full
+	Overflow OverflowPolicy
+	// directory for the SpillToDisk overflow file, "" for the temp dir
+	SpillDir string
+	queue    *msgQueue
+	// guards queue, which Close clears while a Replay may be using it
+	queueMu sync.Mutex
+	// run on Close, after the queue is closed
+	closers []func()
+	// run on the reading goroutine for each message, see OnReceive
+	receivers []func(line []byte, received time.Time)
+	// set while replaying, see Replay
+	replay *replayer
+	// optional, the transport for connections, nil uses http.DefaultTransport
+	Transport http.RoundTripper
+	// set by Instrument
+	metrics *StreamMetrics
+	// OAuth 2.0 bearer tokens, used instead of basic auth or OAuth 1.0a
+	// if set, see NewBearerClient
+	Tokens TokenSource
+	// optional, authenticates each connect attempt, overriding the
+	// credentials above, see Authenticator
+	Auth Authenticator
+	// set by TrackLatency
+	latency *LatencyTracker
+	// see Health
+	health healthState
+	// optional, traces connects and reconnects, and if TraceMessages each
+	// message handled
+	Tracer        Tracer
+	TraceMessages bool
+	// optional, the base url of the twitter v2 api, ie a httpstreamtest
+	// server, nil for https://api.twitter.com
+	APIURL *url.URL
 }
 
 func NewClient(handler func([]byte)) *Client {
 	return &Client{
-		Handler: handler,
-		MaxWait: 300,
+		Handler:   handler,
+		MaxWait:   300,
+		QueueSize: DefaultQueueSize,
 	}
 }
 
-func NewOAuthClient(consumer *oauth.Consumer, token *oauth.AccessToken, handler func([]byte)) *Client {
+// NewOAuthClient creates a client signing its requests with OAuth 1.0a, see
+// OAuth1.
+func NewOAuthClient(consumerKey, consumerSecret, token, tokenSecret string, handler func([]byte)) *Client {
 	return &Client{
-		consumer:    consumer,
-		accessToken: token,
-		Handler:     handler,
-		MaxWait:     300,
+		Auth:      OAuth1(consumerKey, consumerSecret, token, tokenSecret),
+		Handler:   handler,
+		MaxWait:   300,
+		QueueSize: DefaultQueueSize,
 	}
 }
 
 func NewBasicAuthClient(username, password string, handler func([]byte)) *Client {
 	return &Client{
-		Username: username,
-		Password: password,
-		Handler:  handler,
-		MaxWait:  300,
+		Username:  username,
+		Password:  password,
+		Handler:   handler,
+		MaxWait:   300,
+		QueueSize: DefaultQueueSize,
 	}
 }
 
 // Create a new basic Auth Channel Handler
 func NewChannelClient(username, password string, bc chan []byte) *Client {
 	return &Client{
-		Username: username,
-		Password: password,
-		Handler:  func(b []byte) { bc <- b },
-		MaxWait:  300,
+		Username:  username,
+		Password:  password,
+		Handler:   func(b []byte) { bc <- b },
+		MaxWait:   300,
+		QueueSize: DefaultQueueSize,
 	}
 }
 
@@ -258,27 +555,31 @@ func (c *Client) SetMaxWait(max int) {
 // @url = http address
 // @params = http params to be added
 func (c *Client) Connect(url_ *url.URL, params map[string]string, done chan bool) (err error) {
+	return c.connect(url_, params, nil, done)
+}
+
+// connect, with initial params sent on the first attempt but not on
+// reconnects, and extra middleware in front of the client's pipeline for
+// this connection only
+func (c *Client) connect(url_ *url.URL, params, initial map[string]string, done chan bool, extra ...Middleware) (err error) {
 
 	var resp *http.Response
 	sc := NewStreamConn(c.MaxWait)
 
+	sc.c = c
 	sc.url = url_
-	// if http basic auth
-	if c.Username != "" && c.Password != "" {
-		sc.postData = formString(params)
-		sc.authData = "Basic " + encodedAuth(c.Username, c.Password)
-		sc.connect = func() (*http.Response, error) {
-			return sc.basicauthConnect()
-		}
-
-	} else {
-		sc.accessToken = c.accessToken
-		sc.connect = func() (*http.Response, error) {
-			return sc.oauthConnect(params)
-		}
-
+	sc.auth = c.authenticator()
+	sc.initial = initial
+	sc.post = len(params) > 0 || len(initial) > 0
+	sc.connect = func() (*http.Response, error) {
+		sc.form = formString(sc.params(params))
+		return sc.httpConnect()
 	}
-	resp, err = sc.connect()
+	c.health.update(func(h *Health) {
+		h.State = StateConnecting
+		h.URL = url_.String()
+	})
+	resp, err = sc.tracedConnect(context.Background())
 	if err != nil {
 		Log(ERROR, " error ", err)
 		goto Return
@@ -290,6 +591,7 @@ func (c *Client) Connect(url_ *url.URL, params map[string]string, done chan bool
 	if resp.StatusCode != 200 {
 		Debug("not http 200")
 		err = errors.New("stream HTTP Error: " + resp.Status + "\n" + url_.Path)
+		resp.Body.Close()
 		goto Return
 	}
 
@@ -298,12 +600,22 @@ func (c *Client) Connect(url_ *url.URL, params map[string]string, done chan bool
 		c.conn.Close()
 	}
 
+	c.connMu.Lock()
 	c.conn = &sc
+	c.connMu.Unlock()
 
-	go sc.readStream(resp, c.Handler, c.Uniqueid, done)
+	go sc.readStream(resp, c.deliverer(extra...), c.Uniqueid, done)
 
 	return
 Return:
+	c.health.update(func(h *Health) {
+		h.State = StateDisconnected
+		h.Failures++
+		h.Error = "no response"
+		if err != nil {
+			h.Error = err.Error()
+		}
+	})
 	Log(ERROR, "exiting ")
 	done <- true
 	return
@@ -345,14 +657,13 @@ func (c *Client) Filter(userids []int64, topics []string, languages []string, lo
 	}
 
 	if watchStalls {
-		c.Handler = stallWatcher(c.Handler)
+		return c.connect(filterURL, params, nil, done, stallWatcher)
 	}
-
 	return c.Connect(filterURL, params, done)
 }
 
 // A handler wrapper to watch for twitter stall wardings.
-func stallWatcher(handler func([]byte)) func([]byte) {
+func stallWatcher(handler Handler) Handler {
 	/*
 		{ "warning":{
 			"code":"FALLING_BEHIND",
@@ -362,11 +673,9 @@ func stallWatcher(handler func([]byte)) func([]byte) {
 		}
 	*/
 	lookFor := []byte(`"code":"FALLING_BEHIND"`)
-	pctFull := []byte(`"percent_full"`)
 	return func(line []byte) {
 		if bytes.Index(line, lookFor) > 0 {
-			idx := bytes.Index(line, pctFull)
-			Log(ERROR, "FALLING BEHIND!!!!  ", string(line[idx+1:idx+5]))
+			Log(ERROR, "FALLING BEHIND!!!!  ", jsonString(line, "warning", "percent_full"))
 		} else {
 			handler(line)
 		}
@@ -380,17 +689,81 @@ func (c *Client) Sample(done chan bool) error {
 	return c.Connect(sampleURL, nil, done)
 }
 
+// Firehose connects to the Twitter Firehose (elevated access only).
+// https://dev.twitter.com/docs/api/1.1/get/statuses/firehose
+// @count  number of messages to backfill on the initial connect, -150000 to
+// 150000, 0 for none (see Backfill for reconnects)
+// @partition  partition of a split firehose to connect to, "" for all
+func (c *Client) Firehose(count int, partition string, done chan bool) error {
+	params := make(map[string]string)
+	params["stall_warnings"] = "true"
+	var initial map[string]string
+	if count != 0 {
+		initial = map[string]string{"count": strconv.Itoa(count)}
+	}
+	if partition != "" {
+		params["partition"] = partition
+	}
+	return c.connect(firehoseURL, params, initial, done)
+}
+
 // User connects to the Twitter User stream.
 // https://dev.twitter.com/docs/streaming-apis/streams/user
 func (c *Client) User(done chan bool) error {
 	return c.Connect(userURL, nil, done)
 }
 
-// Close closes the client.
+// Close closes the client, throwing away any queued messages rather than
+// waiting for the Handler, see CloseWait.
 func (c *Client) Close() {
+	c.stop()
+	c.queueMu.Lock()
+	q := c.queue
+	c.queue = nil
+	c.queueMu.Unlock()
+	if q != nil {
+		q.Close()
+	}
+	for _, f := range c.closers {
+		f()
+	}
+}
+
+// CloseWait closes the client, first waiting up to timeout (0 for as long as
+// it takes) for the queued messages to be handled, returning false if they
+// weren't and the rest were thrown away.
+func (c *Client) CloseWait(timeout time.Duration) bool {
+	c.stop()
+	drained := true
+	if q := c.msgQueue(); q != nil {
+		drained = q.Drain(timeout)
+	}
+	c.Close()
+	return drained
+}
+
+// stop reading the stream, or replaying
+func (c *Client) stop() {
 	//has it already been closed?
-	if c.conn == nil || c.conn.stale {
-		return
+	if c.conn != nil && !c.conn.isStale() {
+		c.conn.Close()
+	}
+	if c.replay != nil {
+		c.replay.Stop()
 	}
-	c.conn.Close()
+}
+
+// OnReceive registers f to be called with each message and the time it was
+// read off the stream, on the reading goroutine before the queue, so it must
+// be quick.  Middleware runs after the queue, which may be some time later
+// when the Handler is falling behind.
+func (c *Client) OnReceive(f func(line []byte, received time.Time)) {
+	c.receivers = append(c.receivers, f)
+}
+
+// OnClose registers f to be run when the client is closed, after the queue
+// has been closed, and with CloseWait drained.  Use it to drain and shut down
+// handler wrappers such as WorkerPool.
+func (c *Client) OnClose(f func()) {
+	c.closers = append(c.closers, f)
 }
@@ -0,0 +1,315 @@
+package httpstream
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/araddon/httpstream/httpstreamtest"
+)
+
+func init() {
+	backoffUnit = 10 * time.Millisecond
+}
+
+// collect the lines handled, until n have arrived or we time out
+func waitForLines(t *testing.T, lines chan []byte, n int) []string {
+	got := make([]string, 0, n)
+	timeout := time.After(5 * time.Second)
+	for len(got) < n {
+		select {
+		case line := <-lines:
+			got = append(got, string(line))
+		case <-timeout:
+			t.Fatalf("timed out waiting for %d lines, got %v", n, got)
+		}
+	}
+	return got
+}
+
+func TestConnectReconnect(t *testing.T) {
+	srv := httpstreamtest.NewServer(
+		httpstreamtest.Script{
+			httpstreamtest.Message(`{"id_str":"1","text":"one"}`),
+			httpstreamtest.KeepAlive(),
+			httpstreamtest.StallWarning(60),
+			httpstreamtest.SlowWrite(`{"id_str":"2","text":"two"}`, 5, time.Millisecond),
+			httpstreamtest.Drop(),
+		},
+		httpstreamtest.Script{httpstreamtest.Status(503)},
+		httpstreamtest.Script{
+			// replayed by backfill
+			httpstreamtest.Message(`{"id_str":"2","text":"two"}`),
+			httpstreamtest.Message(`{"id_str":"3","text":"three"}`),
+			httpstreamtest.Hold(),
+		},
+	)
+	defer srv.Close()
+	saved := filterURL
+	defer func() { filterURL = saved }()
+	filterURL, _ = url.Parse(srv.URL + "/1.1/statuses/filter.json")
+
+	lines := make(chan []byte, 10)
+	done := make(chan bool, 1)
+	client := NewBasicAuthClient("user", "pwd", func(line []byte) {
+		lines <- line
+	})
+	client.Backfill(100)
+	if err := client.Filter(nil, []string{"golang"}, nil, nil, true, done); err != nil {
+		t.Fatal(err)
+	}
+	got := waitForLines(t, lines, 3)
+	client.Close()
+
+	if strings.Join(got, "\n") != `{"id_str":"1","text":"one"}
+{"id_str":"2","text":"two"}
+{"id_str":"3","text":"three"}` {
+		t.Errorf("unexpected lines %v", got)
+	}
+	reqs := srv.Requests()
+	if len(reqs) != 3 {
+		t.Fatalf("expected 3 connections got %d", len(reqs))
+	}
+	for _, req := range reqs {
+		if req.Method != "POST" || req.Header.Get("Authorization") != "Basic "+encodedAuth("user", "pwd") {
+			t.Errorf("unexpected request %v %v", req.Method, req.Header)
+		}
+		if req.Form.Get("track") != "golang" || req.Form.Get("stall_warnings") != "true" {
+			t.Errorf("unexpected params %v", req.Form)
+		}
+	}
+	if reqs[0].Form.Get("count") != "" || reqs[2].Form.Get("count") == "" {
+		t.Errorf("expected backfill count on reconnect only %v %v", reqs[0].Form, reqs[2].Form)
+	}
+}
+
+func TestConnectUnauthorized(t *testing.T) {
+	srv := httpstreamtest.NewServer(httpstreamtest.Script{httpstreamtest.Status(401)})
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	done := make(chan bool, 1)
+	client := NewBasicAuthClient("user", "wrong", func(line []byte) {})
+	err := client.Connect(u, nil, done)
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected a 401 error got %v", err)
+	}
+	select {
+	case <-done:
+	default:
+		t.Error("expected done")
+	}
+	if reqs := srv.Requests(); len(reqs) != 1 || reqs[0].Method != "GET" {
+		t.Errorf("expected a GET with no params got %v", reqs)
+	}
+}
+
+func TestConnectFaults(t *testing.T) {
+	long := `{"id_str":"2","text":"` + strings.Repeat("x", 2000) + `"}`
+	srv := httpstreamtest.NewUnstartedServer(
+		httpstreamtest.Script{
+			httpstreamtest.Message(`{"id_str":"1","text":"one"}`),
+			httpstreamtest.Message(long),
+			httpstreamtest.Hold(),
+		},
+		httpstreamtest.Script{
+			httpstreamtest.Message(`{"id_str":"3","text":"three"}`),
+			httpstreamtest.Message(long),
+			httpstreamtest.Hold(),
+		},
+		httpstreamtest.Script{
+			httpstreamtest.Message(`{"id_str":"4","text":"four"}`),
+			httpstreamtest.Hold(),
+		},
+	)
+	srv.StartTLS()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	ft := httpstreamtest.NewFaultTransport(
+		// line 2 is split over many reads, and reset part way through
+		httpstreamtest.Faults{MaxRead: 7, Latency: time.Millisecond, ResetAfter: 1000},
+		httpstreamtest.Faults{FailHandshake: true},
+		httpstreamtest.Faults{FailHandshake: true},
+		httpstreamtest.Faults{TruncateAfter: 1000},
+	).ForServer(srv)
+
+	lines := make(chan []byte, 10)
+	done := make(chan bool, 1)
+	client := NewBasicAuthClient("user", "pwd", func(line []byte) {
+		lines <- line
+	})
+	client.Transport = ft
+	if err := client.Connect(u, nil, done); err != nil {
+		t.Fatal(err)
+	}
+	got := waitForLines(t, lines, 3)
+	client.Close()
+
+	// the partial lines are dropped, not handled
+	if strings.Join(got, "\n") != `{"id_str":"1","text":"one"}
+{"id_str":"3","text":"three"}
+{"id_str":"4","text":"four"}` {
+		t.Errorf("unexpected lines %v", got)
+	}
+	if n := ft.Dials(); n != 5 {
+		t.Errorf("expected 5 dials got %d", n)
+	}
+	if reqs := srv.Requests(); len(reqs) != 3 {
+		t.Errorf("expected 3 requests got %d", len(reqs))
+	}
+	select {
+	case <-done:
+		t.Error("gave up reconnecting")
+	default:
+	}
+}
+
+func TestFirehoseCount(t *testing.T) {
+	drop := httpstreamtest.Script{httpstreamtest.Message(`{"id_str":"1","text":"one"}`), httpstreamtest.Drop()}
+	srv := httpstreamtest.NewServer(drop, drop, httpstreamtest.Script{httpstreamtest.Hold()})
+	defer srv.Close()
+	saved := firehoseURL
+	defer func() { firehoseURL = saved }()
+	firehoseURL, _ = url.Parse(srv.URL + "/1.1/statuses/firehose.json")
+
+	client := NewBasicAuthClient("user", "pwd", func(line []byte) {})
+	if err := client.Firehose(-100, "", make(chan bool, 1)); err != nil {
+		t.Fatal(err)
+	}
+	reqs := srv.WaitForRequests(3, 5*time.Second)
+	client.Close()
+	if len(reqs) != 3 {
+		t.Fatalf("expected 3 connections got %d", len(reqs))
+	}
+	if reqs[0].Form.Get("count") != "-100" || reqs[1].Form.Get("count") != "" || reqs[2].Form.Get("count") != "" {
+		t.Errorf("expected the count on the initial connect only %v %v %v", reqs[0].Form, reqs[1].Form, reqs[2].Form)
+	}
+}
+
+func TestParamsFuncKeepsGET(t *testing.T) {
+	srv := httpstreamtest.NewServer(httpstreamtest.Script{httpstreamtest.Hold()})
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/stream?track=go")
+
+	client := NewBasicAuthClient("user", "pwd", func(line []byte) {})
+	client.ParamsFunc = func(params map[string]string, info ConnectInfo) map[string]string {
+		params["backfill_minutes"] = "2"
+		return params
+	}
+	if err := client.Connect(u, nil, make(chan bool, 1)); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	req := srv.Requests()[0]
+	if req.Method != "GET" || req.Form.Get("backfill_minutes") != "2" || req.Form.Get("track") != "go" {
+		t.Errorf("expected a GET with the params in the query got %v %v", req.Method, req.URL)
+	}
+}
+
+func TestCloseBlockedHandler(t *testing.T) {
+	srv := httpstreamtest.NewServer(httpstreamtest.Script{
+		httpstreamtest.Messages(`{"id_str":"1","text":"one"}`, `{"id_str":"2","text":"two"}`, `{"id_str":"3","text":"three"}`),
+		httpstreamtest.Hold(),
+	})
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	// nobody reads the second message off the channel
+	stream := make(chan []byte)
+	client := NewChannelClient("user", "pwd", stream)
+	if err := client.Connect(u, nil, make(chan bool, 1)); err != nil {
+		t.Fatal(err)
+	}
+	<-stream
+	deadline := time.Now().Add(5 * time.Second)
+	for client.QueueStats().Depth == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if client.CloseWait(50 * time.Millisecond) {
+		t.Error("expected the drain to time out")
+	}
+	closed := make(chan bool)
+	go func() {
+		client.Close()
+		closed <- true
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Close not to wait for a blocked handler")
+	}
+}
+
+func TestCloseWait(t *testing.T) {
+	srv := httpstreamtest.NewServer(httpstreamtest.Script{
+		httpstreamtest.Messages(`{"id_str":"1","text":"one"}`, `{"id_str":"2","text":"two"}`),
+		httpstreamtest.Hold(),
+	})
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	lines := make(chan []byte, 10)
+	release := make(chan bool)
+	client := NewClient(func(line []byte) {
+		<-release
+		lines <- line
+	})
+	if err := client.Connect(u, nil, make(chan bool, 1)); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for client.QueueStats().Depth == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(release)
+	if !client.CloseWait(5 * time.Second) {
+		t.Error("expected the queue to drain")
+	}
+	if len(lines) != 2 {
+		t.Errorf("expected both messages handled got %d", len(lines))
+	}
+}
+
+func TestHandlerPanic(t *testing.T) {
+	// on the queue's goroutine, and on the reading goroutine
+	for _, queueSize := range []int{DefaultQueueSize, 0} {
+		srv := httpstreamtest.NewServer(httpstreamtest.Script{
+			httpstreamtest.Messages(`{"id_str":"1","text":"boom"}`, `{"id_str":"2","text":"two"}`),
+			httpstreamtest.Hold(),
+		})
+		u, _ := url.Parse(srv.URL)
+
+		lines := make(chan []byte, 10)
+		client := NewClient(func(line []byte) {
+			if strings.Contains(string(line), "boom") {
+				panic("boom")
+			}
+			lines <- line
+		})
+		client.QueueSize = queueSize
+		errs := make(chan error, 10)
+		client.ErrorHandler = func(err error, line []byte) {
+			errs <- err
+		}
+		if err := client.Connect(u, nil, make(chan bool, 1)); err != nil {
+			t.Fatal(err)
+		}
+		got := waitForLines(t, lines, 1)
+		client.Close()
+		srv.Close()
+
+		if got[0] != `{"id_str":"2","text":"two"}` {
+			t.Errorf("expected the line after the panic got %v", got)
+		}
+		select {
+		case err := <-errs:
+			if p, ok := err.(*HandlerPanic); !ok || p.Value != "boom" {
+				t.Errorf("expected a HandlerPanic got %v", err)
+			}
+		default:
+			t.Errorf("expected the panic reported to the ErrorHandler, queue size %d", queueSize)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package httpstream
+
+import (
+	"context"
+	"net/http"
+)
+
+// Tracer starts spans, its shape follows the OpenTelemetry trace.Tracer so
+// an adapter is a few lines:
+//
+//	type otelTracer struct{ trace.Tracer }
+//
+//	func (t otelTracer) Start(ctx context.Context, name string, attrs ...httpstream.Attribute) (context.Context, httpstream.Span) {
+//		ctx, span := t.Tracer.Start(ctx, name, trace.WithAttributes(otelAttributes(attrs)...))
+//		return ctx, otelSpan{span}
+//	}
+//
+// The client starts these spans:
+//
+//	httpstream.connect    each connect attempt: http.url, httpstream.auth,
+//	                      httpstream.attempt, http.status_code
+//	httpstream.reconnect  from losing the connection until reconnected (or
+//	                      giving up), parent of its connect attempts:
+//	                      httpstream.cause, httpstream.attempts
+//	httpstream.message    each message handled, if Client.TraceMessages:
+//	                      httpstream.message_type, httpstream.bytes
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is an operation being traced, see Tracer.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	SetStatus(code StatusCode, description string)
+	End()
+}
+
+// Attribute is a key value pair describing a span, Value is a string, int,
+// int64, float64 or bool.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// StatusCode of a span, the values match OpenTelemetry's codes.Code.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = iota
+	StatusError
+	StatusOK
+)
+
+// NoopTracer is the default Tracer, its spans do nothing.
+type NoopTracer struct{}
+
+func (NoopTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attrs ...Attribute)              {}
+func (noopSpan) RecordError(err error)                         {}
+func (noopSpan) SetStatus(code StatusCode, description string) {}
+func (noopSpan) End()                                          {}
+
+// the client's tracer, or a NoopTracer
+func (conn *streamConn) tracer() Tracer {
+	if conn.c == nil || conn.c.Tracer == nil {
+		return NoopTracer{}
+	}
+	return conn.c.Tracer
+}
+
+// tracedConnect makes a connect attempt inside a httpstream.connect span.
+func (conn *streamConn) tracedConnect(ctx context.Context) (*http.Response, error) {
+	url := *conn.url
+	url.User = nil
+	_, span := conn.tracer().Start(ctx, "httpstream.connect",
+		Attr("http.url", url.String()),
+		Attr("httpstream.auth", authName(conn.auth)),
+		Attr("httpstream.attempt", conn.attempts),
+	)
+	defer span.End()
+	resp, err := conn.connect()
+	switch {
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(StatusError, err.Error())
+	case resp == nil:
+		span.SetStatus(StatusError, "no response")
+	default:
+		span.SetAttributes(Attr("http.status_code", resp.StatusCode))
+		if resp.StatusCode != 200 {
+			span.SetStatus(StatusError, resp.Status)
+		} else {
+			span.SetStatus(StatusOK, "")
+		}
+	}
+	return resp, err
+}
+
+// reconnectSpan starts a httpstream.reconnect span, returning the context
+// for its connect attempts and a func to end it.
+func (conn *streamConn) reconnectSpan(cause string) (context.Context, func(err error)) {
+	ctx, span := conn.tracer().Start(context.Background(), "httpstream.reconnect", Attr("httpstream.cause", cause))
+	first := conn.attempts
+	return ctx, func(err error) {
+		span.SetAttributes(Attr("httpstream.attempts", conn.attempts-first))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(StatusError, err.Error())
+		} else {
+			span.SetStatus(StatusOK, "")
+		}
+		span.End()
+	}
+}
+
+// traceMessages is middleware putting each message in a httpstream.message
+// span, panics are recorded on the span and passed on.
+func traceMessages(tracer Tracer) Middleware {
+	return func(next Handler) Handler {
+		return func(line []byte) {
+			_, span := tracer.Start(context.Background(), "httpstream.message",
+				Attr("httpstream.message_type", MessageType(line)),
+				Attr("httpstream.bytes", len(line)),
+			)
+			defer func() {
+				if r := recover(); r != nil {
+					span.RecordError(&HandlerPanic{Value: r})
+					span.SetStatus(StatusError, "handler panic")
+					span.End()
+					panic(r)
+				}
+				span.End()
+			}()
+			next(line)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package httpstream
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/araddon/httpstream/httpstreamtest"
+)
+
+type testSpan struct {
+	name   string
+	parent *testSpan
+	attrs  map[string]interface{}
+	status StatusCode
+	errs   []error
+	ended  bool
+}
+
+func (s *testSpan) SetAttributes(attrs ...Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+func (s *testSpan) RecordError(err error)                         { s.errs = append(s.errs, err) }
+func (s *testSpan) SetStatus(code StatusCode, description string) { s.status = code }
+func (s *testSpan) End()                                          { s.ended = true }
+
+type spanKey struct{}
+
+// records the spans started, in order
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	span := &testSpan{name: name, attrs: make(map[string]interface{})}
+	span.parent, _ = ctx.Value(spanKey{}).(*testSpan)
+	span.SetAttributes(attrs...)
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (t *testTracer) named(name string) []*testSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	spans := make([]*testSpan, 0)
+	for _, s := range t.spans {
+		if s.name == name {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+func TestTracer(t *testing.T) {
+	srv := httpstreamtest.NewServer(
+		httpstreamtest.Script{
+			httpstreamtest.Message(`{"id_str":"1","text":"one"}`),
+			httpstreamtest.Drop(),
+		},
+		httpstreamtest.Script{httpstreamtest.Status(503)},
+		httpstreamtest.Script{
+			httpstreamtest.Message(`{"delete":{"status":{"id":1,"id_str":"1"}}}`),
+			httpstreamtest.Hold(),
+		},
+	)
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/stream")
+
+	lines := make(chan []byte, 10)
+	done := make(chan bool, 1)
+	client := NewBasicAuthClient("user", "pwd", func(line []byte) {
+		lines <- line
+	})
+	tracer := &testTracer{}
+	client.Tracer = tracer
+	client.TraceMessages = true
+	if err := client.Connect(u, nil, done); err != nil {
+		t.Fatal(err)
+	}
+	waitForLines(t, lines, 2)
+	client.Close()
+
+	connects := tracer.named("httpstream.connect")
+	reconnects := tracer.named("httpstream.reconnect")
+	if len(connects) != 3 || len(reconnects) != 1 {
+		t.Fatalf("expected 3 connects and 1 reconnect got %d %d", len(connects), len(reconnects))
+	}
+	for i, status := range []int{200, 503, 200} {
+		span := connects[i]
+		if !span.ended || span.attrs["http.status_code"] != status || span.attrs["httpstream.attempt"] != i ||
+			span.attrs["http.url"] != u.String() || span.attrs["httpstream.auth"] != "basic" {
+			t.Errorf("unexpected connect span %d %+v", i, span)
+		}
+		if (i == 0) != (span.parent == nil) || (i > 0 && span.parent != reconnects[0]) {
+			t.Errorf("connect %d has the wrong parent %v", i, span.parent)
+		}
+	}
+	if connects[1].status != StatusError || connects[2].status != StatusOK {
+		t.Errorf("unexpected connect statuses %v %v", connects[1].status, connects[2].status)
+	}
+	reconnect := reconnects[0]
+	if !reconnect.ended || reconnect.status != StatusOK || reconnect.attrs["httpstream.attempts"] != 2 {
+		t.Errorf("unexpected reconnect span %+v", reconnect)
+	}
+	if cause := reconnect.attrs["httpstream.cause"]; cause != CauseEOF && cause != CauseReadError {
+		t.Errorf("unexpected reconnect cause %v", cause)
+	}
+
+	messages := tracer.named("httpstream.message")
+	if len(messages) != 2 || messages[0].attrs["httpstream.message_type"] != "tweet" ||
+		messages[1].attrs["httpstream.message_type"] != "delete" || !messages[1].ended {
+		t.Errorf("unexpected message spans %v", messages)
+	}
+}
+
+func TestTraceMessagesPanic(t *testing.T) {
+	tracer := &testTracer{}
+	handler := Chain(func(line []byte) { panic("boom") }, Recovery(nil), traceMessages(tracer))
+	handler([]byte(`{"id_str":"1","text":"one"}`))
+	spans := tracer.named("httpstream.message")
+	if len(spans) != 1 || !spans[0].ended || spans[0].status != StatusError || len(spans[0].errs) != 1 {
+		t.Errorf("expected the panic on the span %+v", spans)
+	}
+}
@@ -1,9 +1,9 @@
 package httpstream
 
 import (
-	//"encoding/json"
+	"encoding/json"
 	"net/url"
-	"regexp"
+	"strconv"
 )
 
 type User struct {
@@ -32,10 +32,10 @@ type User struct {
 	ProfileSidebarBorderColor string
 	ProfileBackgroundTile     bool
 	Protected                 bool
-	StatusesCount             int `json:"statuses_count"`
-	TimeZone                  *string
+	StatusesCount             int     `json:"statuses_count"`
+	TimeZone                  *string `json:"time_zone"`
 	URL                       *string // "url":null
-	UtcOffset                 *int    // "utc_offset":null,
+	UtcOffset                 *int    `json:"utc_offset"` // "utc_offset":null,
 	Verified                  bool
 	ShowAllInlineMedia        *bool `json:"show_all_inline_media"`
 	RawBytes                  []byte
@@ -46,6 +46,80 @@ type User struct {
 	//"default_profile_image":false,
 }
 
+// The accessors below are nil safe, returning the zero value for null
+// fields (or a nil *User), so they can be chained: tweet.User.GetID()
+
+func (u *User) GetID() int64 {
+	if u == nil || u.ID == nil {
+		return 0
+	}
+	return *u.ID
+}
+
+func (u *User) GetIDStr() string {
+	if u == nil || u.IDStr == nil {
+		return ""
+	}
+	return *u.IDStr
+}
+
+func (u *User) GetScreenName() string {
+	if u == nil {
+		return ""
+	}
+	return u.ScreenName
+}
+
+func (u *User) GetDescription() string {
+	if u == nil || u.Description == nil {
+		return ""
+	}
+	return *u.Description
+}
+
+func (u *User) GetFollowing() bool {
+	return u != nil && u.Following != nil && *u.Following
+}
+
+func (u *User) GetLocation() string {
+	if u == nil || u.Location == nil {
+		return ""
+	}
+	return *u.Location
+}
+
+func (u *User) GetNotifications() string {
+	if u == nil || u.Notifications == nil {
+		return ""
+	}
+	return *u.Notifications
+}
+
+func (u *User) GetTimeZone() string {
+	if u == nil || u.TimeZone == nil {
+		return ""
+	}
+	return *u.TimeZone
+}
+
+func (u *User) GetURL() string {
+	if u == nil || u.URL == nil {
+		return ""
+	}
+	return *u.URL
+}
+
+func (u *User) GetUtcOffset() int {
+	if u == nil || u.UtcOffset == nil {
+		return 0
+	}
+	return *u.UtcOffset
+}
+
+func (u *User) GetShowAllInlineMedia() bool {
+	return u != nil && u.ShowAllInlineMedia != nil && *u.ShowAllInlineMedia
+}
+
 type Tweet struct {
 	Text                string
 	Entities            Entity
@@ -53,29 +127,81 @@ type Tweet struct {
 	Source              string
 	Contributors        []Contributor
 	Coordinates         *Coordinate
-	InReplyToScreenName *string
-	InReplyToStatusID   *int64
-	InReplyToUserID     *int64
+	InReplyToScreenName *string `json:"in_reply_to_screen_name"`
+	InReplyToStatusID   *int64  `json:"in_reply_to_status_id"`
+	InReplyToUserID     *int64  `json:"in_reply_to_user_id"`
 	ID                  *int64
-	IDStr               string
-	CreatedAt           string
-	RetweetCount        int32
+	IDStr               string `json:"id_str"`
+	CreatedAt           string `json:"created_at"`
+	RetweetCount        int32  `json:"retweet_count"`
 	Retweeted           *bool
-	PossiblySensitive   *bool
+	PossiblySensitive   *bool `json:"possibly_sensitive"`
 	User                *User
 	RawBytes            []byte
 	Truncated           *bool
 	Place               *Place // "place":null,
+	Lang                string
 	//Geo                     string   // deprecated
-	RetweetedStatus         *Tweet `json:"retweeted_status"`
+	RetweetedStatus   *Tweet `json:"retweeted_status"`
+	QuotedStatusIDStr string `json:"quoted_status_id_str"`
+	QuotedStatus      *Tweet `json:"quoted_status"`
+}
+
+func (t *Tweet) GetID() int64 {
+	if t == nil || t.ID == nil {
+		return 0
+	}
+	return *t.ID
+}
+
+func (t *Tweet) GetUser() *User {
+	if t == nil {
+		return nil
+	}
+	return t.User
+}
+
+func (t *Tweet) GetInReplyToScreenName() string {
+	if t == nil || t.InReplyToScreenName == nil {
+		return ""
+	}
+	return *t.InReplyToScreenName
+}
+
+func (t *Tweet) GetInReplyToStatusID() int64 {
+	if t == nil || t.InReplyToStatusID == nil {
+		return 0
+	}
+	return *t.InReplyToStatusID
+}
+
+func (t *Tweet) GetInReplyToUserID() int64 {
+	if t == nil || t.InReplyToUserID == nil {
+		return 0
+	}
+	return *t.InReplyToUserID
+}
+
+func (t *Tweet) GetRetweeted() bool {
+	return t != nil && t.Retweeted != nil && *t.Retweeted
+}
+
+func (t *Tweet) GetPossiblySensitive() bool {
+	return t != nil && t.PossiblySensitive != nil && *t.PossiblySensitive
+}
+
+func (t *Tweet) GetTruncated() bool {
+	return t != nil && t.Truncated != nil && *t.Truncated
 }
 
+// Return the expanded urls found in the tweet entities, urls which have
+// a null expanded_url are skipped.
 func (t *Tweet) URLs() []string {
-	if len(t.Entities.URLs) > 0 {
+	if t != nil && len(t.Entities.URLs) > 0 {
 		urls := make([]string, 0)
 		for _, u := range t.Entities.URLs {
-			if len(*u.ExpandedURL) > 0 {
-				if eu, err := url.QueryUnescape(*u.ExpandedURL); err == nil {
+			if expanded := u.GetExpandedURL(); len(expanded) > 0 {
+				if eu, err := url.QueryUnescape(expanded); err == nil {
 					urls = append(urls, eu)
 				}
 			}
@@ -86,7 +212,7 @@ func (t *Tweet) URLs() []string {
 }
 
 func (t *Tweet) Hashes() []string {
-	if len(t.Entities.Hashtags) > 0 {
+	if t != nil && len(t.Entities.Hashtags) > 0 {
 		tags := make([]string, 0)
 		for _, t := range t.Entities.Hashtags {
 			tags = append(tags, t.Text)
@@ -98,7 +224,7 @@ func (t *Tweet) Hashes() []string {
 
 // Return a list of usernames found in the tweet entity mentions
 func (t *Tweet) Mentions() []string {
-	if len(t.Entities.UserMentions) > 0 {
+	if t != nil && len(t.Entities.UserMentions) > 0 {
 		users := make([]string, 0)
 		for _, m := range t.Entities.UserMentions {
 			users = append(users, m.ScreenName)
@@ -109,7 +235,8 @@ func (t *Tweet) Mentions() []string {
 }
 
 // Create a nullable coordinates, as the data comes across like so:
-//    "coordinates":null,
+//
+//	"coordinates":null,
 type Coordinate struct {
 	Coordinates []float64
 	Type        string
@@ -134,25 +261,25 @@ type BoundingBox struct {
 }
 
 /*
-func (c *Coordinate) UnmarshalJSON(data []byte) error {
-	// do we need this, can't we just use pointer?
-	if len(data) > 0 {
-		m := make(map[string]interface{})
-		if err := json.Unmarshal(data, m); err == nil {
-			if co, ok := m["coordinates"]; ok {
-				if cof, ok := co.([]float64); ok {
-					c.Coordinates = cof
+	func (c *Coordinate) UnmarshalJSON(data []byte) error {
+		// do we need this, can't we just use pointer?
+		if len(data) > 0 {
+			m := make(map[string]interface{})
+			if err := json.Unmarshal(data, m); err == nil {
+				if co, ok := m["coordinates"]; ok {
+					if cof, ok := co.([]float64); ok {
+						c.Coordinates = cof
+					}
 				}
-			}
-			if ty, ok := m["type"]; ok {
-				if tys, ok := ty.(string); ok {
-					c.Type = tys
+				if ty, ok := m["type"]; ok {
+					if tys, ok := ty.(string); ok {
+						c.Type = tys
+					}
 				}
 			}
 		}
+		return nil
 	}
-	return nil
-}
 */
 type Contributor struct {
 	ID         int64
@@ -175,7 +302,7 @@ type Event struct {
 type Entity struct {
 	Hashtags     []Hashtag
 	URLs         []TwitterURL
-	UserMentions []Mention
+	UserMentions []Mention `json:"user_mentions"`
 	Media        []Media
 }
 
@@ -185,32 +312,90 @@ type Hashtag struct {
 }
 
 // A twitter url
-//  "urls":[{"indices":[123,136],"url":"http:\/\/t.co\/a","display_url":null,"expanded_url":null}]
+//
+//	"urls":[{"indices":[123,136],"url":"http:\/\/t.co\/a","display_url":null,"expanded_url":null}]
 type TwitterURL struct {
 	URL         string
-	ExpandedURL *string // may be null
-	DisplayURL  *string // may be null if it gets chopped off after t.co because of shortenring
+	ExpandedURL *string `json:"expanded_url"` // may be null
+	DisplayURL  *string `json:"display_url"`  // may be null if it gets chopped off after t.co because of shortenring
 	Indices     []int
 }
+
+func (u *TwitterURL) GetExpandedURL() string {
+	if u == nil || u.ExpandedURL == nil {
+		return ""
+	}
+	return *u.ExpandedURL
+}
+
+func (u *TwitterURL) GetDisplayURL() string {
+	if u == nil || u.DisplayURL == nil {
+		return ""
+	}
+	return *u.DisplayURL
+}
+
 type Mention struct {
-	ScreenName string
+	ScreenName string  `json:"screen_name"`
 	Name       *string // No idea why this could be null, if a username gets mentioned that doesn't exist?
 	ID         *int64
-	IDStr      string
+	IDStr      string `json:"id_str"`
 	Indices    []int
 }
 
+// UnmarshalJSON accepts float encoded ids ("id": 8.9914089e+07), which some
+// streams send, preferring the exact id_str when there is one.
+func (m *Mention) UnmarshalJSON(data []byte) error {
+	type mention Mention
+	var raw struct {
+		mention
+		ID *json.Number
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = Mention(raw.mention)
+	m.ID = nil
+	if id, err := strconv.ParseInt(m.IDStr, 10, 64); err == nil {
+		m.ID = &id
+	} else if raw.ID != nil {
+		if id, err := raw.ID.Int64(); err == nil {
+			m.ID = &id
+		} else if f, err := raw.ID.Float64(); err == nil {
+			id := int64(f)
+			m.ID = &id
+		} else {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Mention) GetName() string {
+	if m == nil || m.Name == nil {
+		return ""
+	}
+	return *m.Name
+}
+
+func (m *Mention) GetID() int64 {
+	if m == nil || m.ID == nil {
+		return 0
+	}
+	return *m.ID
+}
+
 type Media struct {
 	ID            int64
-	IDStr         string
-	DisplayURL    string
-	ExpandedURL   string
+	IDStr         string `json:"id_str"`
+	DisplayURL    string `json:"display_url"`
+	ExpandedURL   string `json:"expanded_url"`
 	Indices       []int
-	MediaURL      string
-	MediaURLHTTPS string
+	MediaURL      string `json:"media_url"`
+	MediaURLHTTPS string `json:"media_url_https"`
 	URL           string
 	Type          string
-	ScreenName    string
+	ScreenName    string `json:"screen_name"`
 	Sizes         Sizes
 }
 
@@ -243,12 +428,8 @@ The twitter stream contains non-tweets (deletes)
 {"delete":{"status":{"user_id_str":"156157535","id_str":"190608148829179907","id":190608148829179907,"user_id":156157535}}}
 
 */
-// a function to filter out the delete messages
+// a function to filter out the delete messages, see also the OnlyTweets
+// middleware
 func OnlyTweetsFilter(handler func([]byte)) func([]byte) {
-	delTw := regexp.MustCompile(`{"delete":`)
-	return func(line []byte) {
-		if delTw.Find(line) != nil {
-			handler(line)
-		}
-	}
+	return OnlyTweets()(handler)
 }
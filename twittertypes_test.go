@@ -71,3 +71,57 @@ func TestDecodeTweet1Test(t *testing.T) {
 	//err = json.Unmarshal([]byte(tweet2), &tw2)
 	//log.Println(err)
 }
+
+func TestNilAccessors(t *testing.T) {
+	var tw *Tweet
+	if tw.GetID() != 0 || tw.GetUser().GetID() != 0 || tw.GetUser().GetScreenName() != "" || tw.GetRetweeted() {
+		t.Error("expected zero values from nil tweet")
+	}
+	if tw.URLs() != nil || tw.Hashes() != nil || tw.Mentions() != nil {
+		t.Error("expected no entities from nil tweet")
+	}
+	tw = &Tweet{Entities: Entity{URLs: []TwitterURL{{URL: "http://t.co/"}}}}
+	if urls := tw.URLs(); len(urls) != 0 {
+		t.Errorf("expected no urls got %v", urls)
+	}
+	for _, js := range tweets {
+		tw := Tweet{}
+		json.Unmarshal([]byte(js), &tw)
+		tw.URLs()
+		for _, m := range tw.Entities.UserMentions {
+			// some mentions come with a null name and id
+			if m.ScreenName == "" || (m.GetID() == 0) != (m.GetName() == "") {
+				t.Errorf("unexpected mention %v", m)
+			}
+		}
+	}
+}
+
+func TestMentionFloatID(t *testing.T) {
+	var m Mention
+	if err := json.Unmarshal([]byte(`{"id": 8.9914089e+07,"id_str": "89914089","screen_name": "Chris_Giarrusso"}`), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.GetID() != 89914089 || m.ScreenName != "Chris_Giarrusso" {
+		t.Errorf("unexpected mention %+v", m)
+	}
+	m = Mention{}
+	if err := json.Unmarshal([]byte(`{"id": 8.9914089e+07}`), &m); err != nil || m.GetID() != 89914089 {
+		t.Errorf("expected the float id without an id_str got %d %v", m.GetID(), err)
+	}
+}
+
+func TestUserTimeZone(t *testing.T) {
+	var u User
+	if err := json.Unmarshal([]byte(`{"id_str":"1","screen_name":"bob","time_zone":"Pacific Time (US & Canada)","utc_offset":-28800}`), &u); err != nil {
+		t.Fatal(err)
+	}
+	if u.GetTimeZone() != "Pacific Time (US & Canada)" || u.GetUtcOffset() != -28800 {
+		t.Errorf("unexpected time zone %q %d", u.GetTimeZone(), u.GetUtcOffset())
+	}
+	u = User{}
+	json.Unmarshal([]byte(`{"time_zone":null,"utc_offset":null}`), &u)
+	if u.GetTimeZone() != "" || u.GetUtcOffset() != 0 {
+		t.Errorf("expected zero values for nulls got %q %d", u.GetTimeZone(), u.GetUtcOffset())
+	}
+}
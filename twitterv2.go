@@ -0,0 +1,327 @@
+package httpstream
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Twitter API v2 payloads, see
+// https://developer.twitter.com/en/docs/twitter-api/data-dictionary/introduction
+//
+// Fields are only present if asked for with the tweet.fields, user.fields etc
+// params, and related objects (the author, media, quoted tweets) arrive in
+// the includes of the response, see StreamResponseV2.Hydrate.
+
+type TweetV2 struct {
+	ID                string               `json:"id"`
+	Text              string               `json:"text"`
+	AuthorID          string               `json:"author_id,omitempty"`
+	ConversationID    string               `json:"conversation_id,omitempty"`
+	CreatedAt         string               `json:"created_at,omitempty"` // RFC 3339
+	InReplyToUserID   string               `json:"in_reply_to_user_id,omitempty"`
+	Lang              string               `json:"lang,omitempty"`
+	PossiblySensitive bool                 `json:"possibly_sensitive,omitempty"`
+	Source            string               `json:"source,omitempty"`
+	ReplySettings     string               `json:"reply_settings,omitempty"`
+	ReferencedTweets  []*ReferencedTweetV2 `json:"referenced_tweets,omitempty"`
+	Attachments       *AttachmentsV2       `json:"attachments,omitempty"`
+	Geo               *TweetGeoV2          `json:"geo,omitempty"`
+	Entities          *EntitiesV2          `json:"entities,omitempty"`
+	PublicMetrics     *TweetMetricsV2      `json:"public_metrics,omitempty"`
+
+	// set from the includes by Hydrate
+	Author *UserV2    `json:"-"`
+	Media  []*MediaV2 `json:"-"`
+	Polls  []*PollV2  `json:"-"`
+	Place  *PlaceV2   `json:"-"`
+}
+
+// Return the expanded urls found in the tweet entities, like Tweet.URLs
+func (t *TweetV2) URLs() []string {
+	if t.Entities == nil || len(t.Entities.URLs) == 0 {
+		return nil
+	}
+	urls := make([]string, 0)
+	for _, u := range t.Entities.URLs {
+		if len(u.ExpandedURL) > 0 {
+			if eu, err := url.QueryUnescape(u.ExpandedURL); err == nil {
+				urls = append(urls, eu)
+			}
+		}
+	}
+	return urls
+}
+
+func (t *TweetV2) Hashes() []string {
+	if t.Entities == nil || len(t.Entities.Hashtags) == 0 {
+		return nil
+	}
+	tags := make([]string, 0)
+	for _, h := range t.Entities.Hashtags {
+		tags = append(tags, h.Tag)
+	}
+	return tags
+}
+
+// Return a list of usernames found in the tweet entity mentions
+func (t *TweetV2) Mentions() []string {
+	if t.Entities == nil || len(t.Entities.Mentions) == 0 {
+		return nil
+	}
+	users := make([]string, 0)
+	for _, m := range t.Entities.Mentions {
+		users = append(users, m.Username)
+	}
+	return users
+}
+
+// ReferencedTweetV2 is a tweet this one retweets, quotes or replies to.
+type ReferencedTweetV2 struct {
+	// retweeted, quoted or replied_to
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	// set from the includes by Hydrate, nil if not included
+	Tweet *TweetV2 `json:"-"`
+}
+
+type AttachmentsV2 struct {
+	MediaKeys []string `json:"media_keys,omitempty"`
+	PollIDs   []string `json:"poll_ids,omitempty"`
+}
+
+type TweetGeoV2 struct {
+	PlaceID     string      `json:"place_id,omitempty"`
+	Coordinates *Coordinate `json:"coordinates,omitempty"`
+}
+
+// EntitiesV2 are positioned by start and end offsets in unicode codepoints.
+type EntitiesV2 struct {
+	Hashtags []*TagV2     `json:"hashtags,omitempty"`
+	Cashtags []*TagV2     `json:"cashtags,omitempty"`
+	Mentions []*MentionV2 `json:"mentions,omitempty"`
+	URLs     []*URLV2     `json:"urls,omitempty"`
+}
+
+type TagV2 struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Tag   string `json:"tag"`
+}
+
+type MentionV2 struct {
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	Username string `json:"username"`
+	ID       string `json:"id,omitempty"`
+}
+
+type URLV2 struct {
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	URL         string `json:"url"`
+	ExpandedURL string `json:"expanded_url,omitempty"`
+	DisplayURL  string `json:"display_url,omitempty"`
+	UnwoundURL  string `json:"unwound_url,omitempty"`
+	MediaKey    string `json:"media_key,omitempty"`
+}
+
+type TweetMetricsV2 struct {
+	RetweetCount int `json:"retweet_count"`
+	ReplyCount   int `json:"reply_count"`
+	LikeCount    int `json:"like_count"`
+	QuoteCount   int `json:"quote_count"`
+}
+
+type UserV2 struct {
+	ID              string         `json:"id"`
+	Name            string         `json:"name"`
+	Username        string         `json:"username"`
+	CreatedAt       string         `json:"created_at,omitempty"`
+	Description     string         `json:"description,omitempty"`
+	Location        string         `json:"location,omitempty"`
+	ProfileImageURL string         `json:"profile_image_url,omitempty"`
+	URL             string         `json:"url,omitempty"`
+	Protected       bool           `json:"protected,omitempty"`
+	Verified        bool           `json:"verified,omitempty"`
+	PublicMetrics   *UserMetricsV2 `json:"public_metrics,omitempty"`
+}
+
+type UserMetricsV2 struct {
+	FollowersCount int `json:"followers_count"`
+	FollowingCount int `json:"following_count"`
+	TweetCount     int `json:"tweet_count"`
+	ListedCount    int `json:"listed_count"`
+}
+
+type MediaV2 struct {
+	MediaKey        string `json:"media_key"`
+	Type            string `json:"type"` // photo, video or animated_gif
+	URL             string `json:"url,omitempty"`
+	PreviewImageURL string `json:"preview_image_url,omitempty"`
+	Width           int    `json:"width,omitempty"`
+	Height          int    `json:"height,omitempty"`
+	DurationMs      int    `json:"duration_ms,omitempty"`
+	AltText         string `json:"alt_text,omitempty"`
+}
+
+type PlaceV2 struct {
+	ID          string      `json:"id"`
+	FullName    string      `json:"full_name"`
+	Name        string      `json:"name,omitempty"`
+	Country     string      `json:"country,omitempty"`
+	CountryCode string      `json:"country_code,omitempty"`
+	PlaceType   string      `json:"place_type,omitempty"`
+	Geo         *PlaceGeoV2 `json:"geo,omitempty"`
+}
+
+// PlaceGeoV2 is a geojson Feature, with a bbox of [west, south, east, north].
+type PlaceGeoV2 struct {
+	Type string    `json:"type"`
+	BBox []float64 `json:"bbox"`
+}
+
+type PollV2 struct {
+	ID              string          `json:"id"`
+	Options         []*PollOptionV2 `json:"options"`
+	VotingStatus    string          `json:"voting_status,omitempty"`
+	EndDatetime     string          `json:"end_datetime,omitempty"`
+	DurationMinutes int             `json:"duration_minutes,omitempty"`
+}
+
+type PollOptionV2 struct {
+	Position int    `json:"position"`
+	Label    string `json:"label"`
+	Votes    int    `json:"votes"`
+}
+
+// IncludesV2 are the objects referenced by the tweet (or tweets) of a response.
+type IncludesV2 struct {
+	Tweets []*TweetV2 `json:"tweets,omitempty"`
+	Users  []*UserV2  `json:"users,omitempty"`
+	Media  []*MediaV2 `json:"media,omitempty"`
+	Places []*PlaceV2 `json:"places,omitempty"`
+	Polls  []*PollV2  `json:"polls,omitempty"`
+}
+
+// MatchingRule is a filtered stream rule that a tweet matched.
+type MatchingRule struct {
+	ID  string `json:"id"`
+	Tag string `json:"tag,omitempty"`
+}
+
+// StreamResponseV2 is a message on a v2 stream:
+//
+//	{"data":{"id":"..","text":".."},"includes":{"users":[..]},"matching_rules":[{"id":"..","tag":".."}]}
+type StreamResponseV2 struct {
+	Data          *TweetV2        `json:"data,omitempty"`
+	Includes      *IncludesV2     `json:"includes,omitempty"`
+	MatchingRules []*MatchingRule `json:"matching_rules,omitempty"`
+	Errors        []*ErrorV2      `json:"errors,omitempty"`
+}
+
+// Hydrate links the tweet (and the tweets it references) to its author,
+// media, polls, place and referenced tweets from the includes.
+func (r *StreamResponseV2) Hydrate() {
+	if r.Data == nil || r.Includes == nil {
+		return
+	}
+	inc := r.Includes
+	users := make(map[string]*UserV2, len(inc.Users))
+	for _, u := range inc.Users {
+		users[u.ID] = u
+	}
+	media := make(map[string]*MediaV2, len(inc.Media))
+	for _, m := range inc.Media {
+		media[m.MediaKey] = m
+	}
+	polls := make(map[string]*PollV2, len(inc.Polls))
+	for _, p := range inc.Polls {
+		polls[p.ID] = p
+	}
+	places := make(map[string]*PlaceV2, len(inc.Places))
+	for _, p := range inc.Places {
+		places[p.ID] = p
+	}
+	tweets := make(map[string]*TweetV2, len(inc.Tweets))
+	for _, t := range inc.Tweets {
+		tweets[t.ID] = t
+	}
+	hydrate := func(t *TweetV2) {
+		t.Author = users[t.AuthorID]
+		t.Media, t.Polls = nil, nil
+		if t.Attachments != nil {
+			for _, key := range t.Attachments.MediaKeys {
+				if m := media[key]; m != nil {
+					t.Media = append(t.Media, m)
+				}
+			}
+			for _, id := range t.Attachments.PollIDs {
+				if p := polls[id]; p != nil {
+					t.Polls = append(t.Polls, p)
+				}
+			}
+		}
+		if t.Geo != nil {
+			t.Place = places[t.Geo.PlaceID]
+		}
+		for _, ref := range t.ReferencedTweets {
+			ref.Tweet = tweets[ref.ID]
+		}
+	}
+	hydrate(r.Data)
+	for _, t := range inc.Tweets {
+		hydrate(t)
+	}
+}
+
+// ErrorV2 is a v2 api error, either a problem in an errors array alongside
+// the data (ie a rule that couldn't be added) or the body of a failed request:
+//
+//	{"title":"DuplicateRule","type":"https://api.twitter.com/2/problems/duplicate-rules","value":"golang","id":"1"}
+type ErrorV2 struct {
+	Title  string `json:"title"`
+	Detail string `json:"detail,omitempty"`
+	Type   string `json:"type,omitempty"`
+	// the http status, on a failed request
+	Status int `json:"status,omitempty"`
+	// the rule value, or resource id, the error is about
+	Value        string `json:"value,omitempty"`
+	ID           string `json:"id,omitempty"`
+	Section      string `json:"section,omitempty"`
+	Parameter    string `json:"parameter,omitempty"`
+	ResourceType string `json:"resource_type,omitempty"`
+	Message      string `json:"message,omitempty"`
+	// set on stream disconnects, ie UpstreamOperationalDisconnect
+	DisconnectType string `json:"disconnect_type,omitempty"`
+}
+
+// Disconnected is whether the error is the server closing the stream, after
+// which the client reconnects.
+func (e *ErrorV2) Disconnected() bool {
+	return e.DisconnectType != "" || e.Title == "operational-disconnect"
+}
+
+func (e *ErrorV2) Error() string {
+	msg := e.Title
+	switch {
+	case e.Detail != "":
+		msg += ": " + e.Detail
+	case e.Message != "":
+		msg += ": " + e.Message
+	}
+	if e.Value != "" {
+		msg += " (" + e.Value + ")"
+	}
+	return msg
+}
+
+// ErrorsV2 are the errors of a partly failed request.
+type ErrorsV2 []*ErrorV2
+
+func (errs ErrorsV2) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
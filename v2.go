@@ -0,0 +1,279 @@
+package httpstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Twitter API v2 filtered stream.
+// https://developer.twitter.com/en/docs/twitter-api/tweets/filtered-stream/introduction
+//
+// Rather than track/follow params the stream is filtered by rules kept on the
+// server, which are added and deleted with AddStreamRules and
+// DeleteStreamRules.  It needs a bearer token, see NewBearerClient.
+
+var twitterAPIURL, _ = url.Parse("https://api.twitter.com")
+
+const (
+	v2StreamPath = "/2/tweets/search/stream"
+	v2RulesPath  = "/2/tweets/search/stream/rules"
+	v2SamplePath = "/2/tweets/sample/stream"
+)
+
+// StreamRule is a filtered stream rule, the ID is set by the server:
+//
+//	httpstream.StreamRule{Value: "golang -is:retweet lang:en", Tag: "golang"}
+type StreamRule struct {
+	ID    string `json:"id,omitempty"`
+	Value string `json:"value"`
+	Tag   string `json:"tag,omitempty"`
+}
+
+// RulesResponse is the response to listing, adding or deleting rules.
+type RulesResponse struct {
+	Data   []StreamRule `json:"data,omitempty"`
+	Meta   RulesMeta    `json:"meta"`
+	Errors ErrorsV2     `json:"errors,omitempty"`
+}
+
+type RulesMeta struct {
+	Sent        string        `json:"sent"`
+	ResultCount int           `json:"result_count,omitempty"`
+	Summary     *RulesSummary `json:"summary,omitempty"`
+}
+
+// RulesSummary counts what an add or delete did, or would do for a dry run.
+type RulesSummary struct {
+	Created    int `json:"created"`
+	NotCreated int `json:"not_created"`
+	Valid      int `json:"valid"`
+	Invalid    int `json:"invalid"`
+	Deleted    int `json:"deleted"`
+	NotDeleted int `json:"not_deleted"`
+}
+
+// FieldsV2 picks the fields and expansions for v2 tweets, by default there is
+// only the id and text:
+//
+//	httpstream.FieldsV2{
+//		Expansions:  []string{"author_id", "attachments.media_keys"},
+//		TweetFields: []string{"created_at", "lang", "entities"},
+//		UserFields:  []string{"username", "verified"},
+//	}
+type FieldsV2 struct {
+	Expansions  []string
+	TweetFields []string
+	UserFields  []string
+	MediaFields []string
+	PlaceFields []string
+	PollFields  []string
+	// minutes of tweets missed while disconnected to backfill, up to 5
+	// (academic access only)
+	BackfillMinutes int
+}
+
+func (f FieldsV2) params() url.Values {
+	params := url.Values{}
+	set := func(key string, values []string) {
+		if len(values) > 0 {
+			params.Set(key, strings.Join(values, ","))
+		}
+	}
+	set("expansions", f.Expansions)
+	set("tweet.fields", f.TweetFields)
+	set("user.fields", f.UserFields)
+	set("media.fields", f.MediaFields)
+	set("place.fields", f.PlaceFields)
+	set("poll.fields", f.PollFields)
+	if f.BackfillMinutes > 0 {
+		params.Set("backfill_minutes", strconv.Itoa(f.BackfillMinutes))
+	}
+	return params
+}
+
+// v2URL is path on the client's APIURL, or api.twitter.com
+func (c *Client) v2URL(path string, params url.Values) *url.URL {
+	base := c.APIURL
+	if base == nil {
+		base = twitterAPIURL
+	}
+	u := *base
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawQuery = params.Encode()
+	return &u
+}
+
+// FilterV2 connects to the v2 filtered stream, which sends the tweets
+// matching the rules set with AddStreamRules.  Use V2Handler to parse them.
+func (c *Client) FilterV2(fields FieldsV2, done chan bool) error {
+	return c.connect(c.v2URL(v2StreamPath, fields.params()), nil, nil, done, c.v2Errors)
+}
+
+// SampleV2 connects to the v2 sampled stream, a random 1% of all tweets.
+// https://developer.twitter.com/en/docs/twitter-api/tweets/volume-streams/introduction
+func (c *Client) SampleV2(fields FieldsV2, done chan bool) error {
+	return c.connect(c.v2URL(v2SamplePath, fields.params()), nil, nil, done, c.v2Errors)
+}
+
+// v2Errors takes the errors sent on a v2 stream out of it, ie before an
+// operational disconnect:
+//
+//	{"errors":[{"title":"operational-disconnect","disconnect_type":"UpstreamOperationalDisconnect",
+//		"detail":"This stream has been disconnected upstream for operational reasons."}]}
+//
+// logging them and passing them (as ErrorsV2) to the ErrorHandler.  Errors
+// alongside a tweet, ie for includes that couldn't be found, are left in
+// the message.
+func (c *Client) v2Errors(handler Handler) Handler {
+	return func(line []byte) {
+		if jsonLookup(line, "errors") == nil || jsonLookup(line, "data") != nil {
+			handler(line)
+			return
+		}
+		msg := StreamResponseV2{}
+		if err := json.Unmarshal(line, &msg); err != nil || len(msg.Errors) == 0 {
+			handler(line)
+			return
+		}
+		err := ErrorsV2(msg.Errors)
+		for _, e := range msg.Errors {
+			if e.Disconnected() {
+				Log(WARN, "stream disconnected by server, will reconnect: ", e)
+				continue
+			}
+			Log(ERROR, "stream error: ", e)
+		}
+		c.health.update(func(h *Health) { h.Error = err.Error() })
+		if c.ErrorHandler != nil {
+			c.ErrorHandler(err, line)
+		}
+	}
+}
+
+// StreamRules lists the filtered stream rules, or those with the given ids.
+func (c *Client) StreamRules(ids ...string) ([]StreamRule, error) {
+	params := url.Values{}
+	if len(ids) > 0 {
+		params.Set("ids", strings.Join(ids, ","))
+	}
+	resp, err := c.rulesRequest("GET", params, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// AddStreamRules adds filtered stream rules, returning them with their ids.
+// With dryRun the rules are validated but not added.  If some rules are not
+// added (ie they are duplicates), the response is returned along with its
+// Errors.
+func (c *Client) AddStreamRules(dryRun bool, rules ...StreamRule) (*RulesResponse, error) {
+	add := make([]StreamRule, len(rules))
+	for i, r := range rules {
+		add[i] = StreamRule{Value: r.Value, Tag: r.Tag}
+	}
+	return c.rulesRequest("POST", dryRunParams(dryRun), map[string]interface{}{"add": add})
+}
+
+// DeleteStreamRules deletes the filtered stream rules with the given ids,
+// with dryRun only checking they could be.
+func (c *Client) DeleteStreamRules(dryRun bool, ids ...string) (*RulesResponse, error) {
+	body := map[string]interface{}{"delete": map[string][]string{"ids": ids}}
+	return c.rulesRequest("POST", dryRunParams(dryRun), body)
+}
+
+func dryRunParams(dryRun bool) url.Values {
+	if dryRun {
+		return url.Values{"dry_run": {"true"}}
+	}
+	return nil
+}
+
+// rulesRequest makes a request to the rules endpoint, with the client's
+// Transport and auth.
+func (c *Client) rulesRequest(method string, params url.Values, body interface{}) (*RulesResponse, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	u := c.v2URL(v2RulesPath, params)
+	newReq := func() (*http.Request, error) {
+		req, err := http.NewRequest(method, u.String(), bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		return req, nil
+	}
+	client := &http.Client{Transport: c.Transport}
+	resp, err := doAuthenticated(client, c.authenticator(), newReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, v2RequestError(resp, respBody)
+	}
+	rules := &RulesResponse{}
+	if err = json.Unmarshal(respBody, rules); err != nil {
+		return nil, err
+	}
+	if len(rules.Errors) > 0 {
+		return rules, rules.Errors
+	}
+	return rules, nil
+}
+
+// v2RequestError is the error for a failed v2 request, from its problem body
+// if it has one.
+func v2RequestError(resp *http.Response, body []byte) error {
+	var problem struct {
+		ErrorV2
+		Errors ErrorsV2 `json:"errors"`
+	}
+	if json.Unmarshal(body, &problem) == nil {
+		if problem.Title != "" {
+			if problem.Status == 0 {
+				problem.Status = resp.StatusCode
+			}
+			return &problem.ErrorV2
+		}
+		if len(problem.Errors) > 0 {
+			return problem.Errors
+		}
+	}
+	return fmt.Errorf("v2 request failed: %s %s", resp.Status, body)
+}
+
+// V2Handler parses each v2 stream message, hydrating its includes, for
+// handler:
+//
+//	client := httpstream.NewBearerClient(tokens, httpstream.V2Handler(func(msg *httpstream.StreamResponseV2) {
+//		fmt.Println(msg.Data.Author.Username, msg.Data.Text)
+//	}))
+func V2Handler(handler func(*StreamResponseV2)) func([]byte) {
+	return func(line []byte) {
+		msg := &StreamResponseV2{}
+		if err := json.Unmarshal(line, msg); err != nil {
+			Log(ERROR, "invalid v2 message: ", err, " ", string(line))
+			return
+		}
+		msg.Hydrate()
+		handler(msg)
+	}
+}
@@ -0,0 +1,203 @@
+package httpstream
+
+import (
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/araddon/httpstream/httpstreamtest"
+)
+
+func TestStreamRules(t *testing.T) {
+	srv := httpstreamtest.NewServer()
+	defer srv.Close()
+	rules := &httpstreamtest.Rules{Token: "t1"}
+	srv.Handle(httpstreamtest.RulesPath, rules)
+
+	client := NewBearerClient(StaticToken("t1"), func(line []byte) {})
+	client.APIURL, _ = url.Parse(srv.URL)
+
+	// a dry run checks the rules without adding them
+	resp, err := client.AddStreamRules(true, StreamRule{Value: "golang", Tag: "go"})
+	if err != nil || resp.Meta.Summary == nil || resp.Meta.Summary.Valid != 1 {
+		t.Fatalf("unexpected dry run %+v %v", resp, err)
+	}
+	if len(rules.List()) != 0 {
+		t.Errorf("expected no rules after a dry run got %v", rules.List())
+	}
+
+	resp, err = client.AddStreamRules(false, StreamRule{Value: "golang", Tag: "go"}, StreamRule{Value: "rustlang"})
+	if err != nil || len(resp.Data) != 2 || resp.Data[0].ID == "" || resp.Data[0].Tag != "go" {
+		t.Fatalf("unexpected add %+v %v", resp, err)
+	}
+	goID := resp.Data[0].ID
+
+	// duplicates are reported, the rest are added
+	resp, err = client.AddStreamRules(false, StreamRule{Value: "golang"}, StreamRule{Value: "python"})
+	errs, ok := err.(ErrorsV2)
+	if !ok || len(errs) != 1 || errs[0].Title != "DuplicateRule" || errs[0].ID != goID {
+		t.Errorf("expected a duplicate rule error got %v", err)
+	}
+	if resp == nil || resp.Meta.Summary.Created != 1 || resp.Meta.Summary.NotCreated != 1 {
+		t.Errorf("unexpected summary %+v", resp)
+	}
+
+	list, err := client.StreamRules()
+	if err != nil || len(list) != 3 {
+		t.Fatalf("expected 3 rules got %v %v", list, err)
+	}
+	if list, _ = client.StreamRules(goID); len(list) != 1 || list[0].Value != "golang" {
+		t.Errorf("expected the golang rule got %v", list)
+	}
+
+	if resp, err = client.DeleteStreamRules(true, goID); err != nil || resp.Meta.Summary.Deleted != 1 || len(rules.List()) != 3 {
+		t.Errorf("unexpected dry run delete %+v %v", resp, err)
+	}
+	if resp, err = client.DeleteStreamRules(false, goID); err != nil || resp.Meta.Summary.Deleted != 1 {
+		t.Errorf("unexpected delete %+v %v", resp, err)
+	}
+	if list, _ = client.StreamRules(); len(list) != 2 {
+		t.Errorf("expected 2 rules left got %v", list)
+	}
+
+	client.Auth = BearerAuth(StaticToken("wrong"))
+	_, err = client.StreamRules()
+	if e, ok := err.(*ErrorV2); !ok || e.Status != 401 || e.Title != "Unauthorized" {
+		t.Errorf("expected an unauthorized error got %v", err)
+	}
+}
+
+func TestFilterV2(t *testing.T) {
+	srv := httpstreamtest.NewServer(httpstreamtest.Script{
+		httpstreamtest.Message(`{"data":{"id":"2","text":"hi @bob","author_id":"10","attachments":{"media_keys":["3_1"]},` +
+			`"referenced_tweets":[{"type":"quoted","id":"1"}],"entities":{"mentions":[{"start":3,"end":7,"username":"bob","id":"11"}]}},` +
+			`"includes":{"users":[{"id":"10","name":"Alice","username":"alice"},{"id":"11","name":"Bob","username":"bob"}],` +
+			`"media":[{"media_key":"3_1","type":"photo","url":"https://pbs.twimg.com/media/1.jpg"}],` +
+			`"tweets":[{"id":"1","text":"original","author_id":"11"}]},` +
+			`"matching_rules":[{"id":"100","tag":"greetings"}]}`),
+		httpstreamtest.Hold(),
+	})
+	defer srv.Close()
+
+	msgs := make(chan *StreamResponseV2, 10)
+	client := NewBearerClient(StaticToken("t1"), V2Handler(func(msg *StreamResponseV2) {
+		msgs <- msg
+	}))
+	client.APIURL, _ = url.Parse(srv.URL)
+	fields := FieldsV2{
+		Expansions:  []string{"author_id", "attachments.media_keys", "referenced_tweets.id"},
+		TweetFields: []string{"created_at", "entities"},
+	}
+	if err := client.FilterV2(fields, make(chan bool, 1)); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-msgs
+	client.Close()
+
+	req := srv.Requests()[0]
+	if req.Method != "GET" || req.URL.Path != "/2/tweets/search/stream" || req.Header.Get("Authorization") != "Bearer t1" {
+		t.Errorf("unexpected request %v %v %v", req.Method, req.URL, req.Header)
+	}
+	if req.Form.Get("expansions") != "author_id,attachments.media_keys,referenced_tweets.id" || req.Form.Get("tweet.fields") != "created_at,entities" {
+		t.Errorf("unexpected params %v", req.Form)
+	}
+
+	tw := msg.Data
+	if tw.Author == nil || tw.Author.Username != "alice" {
+		t.Errorf("expected author alice got %+v", tw.Author)
+	}
+	if len(tw.Media) != 1 || tw.Media[0].Type != "photo" {
+		t.Errorf("unexpected media %+v", tw.Media)
+	}
+	quoted := tw.ReferencedTweets[0].Tweet
+	if quoted == nil || quoted.Text != "original" || quoted.Author == nil || quoted.Author.Username != "bob" {
+		t.Errorf("expected the quoted tweet by bob got %+v", quoted)
+	}
+	if len(msg.MatchingRules) != 1 || msg.MatchingRules[0].Tag != "greetings" {
+		t.Errorf("unexpected matching rules %v", msg.MatchingRules)
+	}
+}
+
+func TestSampleV2(t *testing.T) {
+	srv := httpstreamtest.NewServer(
+		httpstreamtest.Script{
+			httpstreamtest.Message(`{"data":{"id":"1","text":"one"}}`),
+			httpstreamtest.Message(`{"errors":[{"title":"operational-disconnect","disconnect_type":"UpstreamOperationalDisconnect",` +
+				`"detail":"This stream has been disconnected upstream for operational reasons.",` +
+				`"type":"https://api.twitter.com/2/problems/operational-disconnect"}]}`),
+			httpstreamtest.Drop(),
+		},
+		httpstreamtest.Script{
+			httpstreamtest.Message(`{"data":{"id":"2","text":"two"}}`),
+			httpstreamtest.Hold(),
+		},
+	)
+	defer srv.Close()
+
+	msgs := make(chan *StreamResponseV2, 10)
+	client := NewBearerClient(StaticToken("t1"), V2Handler(func(msg *StreamResponseV2) {
+		msgs <- msg
+	}))
+	client.APIURL, _ = url.Parse(srv.URL)
+	var mu sync.Mutex
+	var streamErrs []error
+	client.ErrorHandler = func(err error, line []byte) {
+		mu.Lock()
+		streamErrs = append(streamErrs, err)
+		mu.Unlock()
+	}
+	fields := FieldsV2{TweetFields: []string{"entities"}, UserFields: []string{"username"}, PlaceFields: []string{"geo"}}
+	if err := client.SampleV2(fields, make(chan bool, 1)); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"one", "two"} {
+		select {
+		case msg := <-msgs:
+			if msg.Data == nil || msg.Data.Text != want {
+				t.Errorf("expected %s got %+v", want, msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+	client.Close()
+
+	reqs := srv.Requests()
+	if reqs[0].URL.Path != "/2/tweets/sample/stream" || reqs[0].Form.Get("place.fields") != "geo" || reqs[0].Form.Get("user.fields") != "username" {
+		t.Errorf("unexpected request %v", reqs[0].URL)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(streamErrs) != 1 {
+		t.Fatalf("expected the disconnect error got %v", streamErrs)
+	}
+	if errs, ok := streamErrs[0].(ErrorsV2); !ok || !errs[0].Disconnected() {
+		t.Errorf("expected an operational disconnect got %v", streamErrs[0])
+	}
+}
+
+func TestTweetV2Entities(t *testing.T) {
+	tw := &TweetV2{Text: "#go @bob https://t.co/x"}
+	if tw.Hashes() != nil || tw.Mentions() != nil || tw.URLs() != nil {
+		t.Error("expected no entities")
+	}
+	tw.Entities = &EntitiesV2{
+		Hashtags: []*TagV2{{Start: 0, End: 3, Tag: "go"}},
+		Mentions: []*MentionV2{{Start: 4, End: 8, Username: "bob"}},
+		URLs: []*URLV2{
+			{Start: 9, End: 23, URL: "https://t.co/x", ExpandedURL: "https://golang.org/doc/?q=a%20b"},
+			{URL: "https://t.co/y"},
+		},
+	}
+	if got := tw.Hashes(); !reflect.DeepEqual(got, []string{"go"}) {
+		t.Errorf("unexpected hashes %v", got)
+	}
+	if got := tw.Mentions(); !reflect.DeepEqual(got, []string{"bob"}) {
+		t.Errorf("unexpected mentions %v", got)
+	}
+	if got := tw.URLs(); !reflect.DeepEqual(got, []string{"https://golang.org/doc/?q=a b"}) {
+		t.Errorf("unexpected urls %v", got)
+	}
+}
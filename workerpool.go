@@ -0,0 +1,99 @@
+package httpstream
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// KeyFunc extracts an ordering key from a message, messages with the same
+// key are handled in order.  "" means the message has no ordering.
+type KeyFunc func(line []byte) string
+
+// UserIDKey keys tweets by the id of the user that sent them.
+func UserIDKey(line []byte) string {
+	return jsonString(line, "user", "id_str")
+}
+
+// WorkerPool is a handler wrapper that runs the handler on n goroutines.
+// With a KeyFunc, messages with the same key always go to the same worker so
+// are handled in the order received, while different keys run in parallel.
+//
+//	pool := httpstream.NewWorkerPool(8, httpstream.UserIDKey, handler)
+//	client := httpstream.NewBasicAuthClient(user, pwd, pool.Handle)
+//	client.OnClose(pool.Close)
+type WorkerPool struct {
+	handler func([]byte)
+	key     KeyFunc
+	// optional, called with the error and line when the handler panics
+	ErrorHandler func(err error, line []byte)
+	// per worker queues for keyed messages, and a shared one for the rest
+	keyed  []chan []byte
+	shared chan []byte
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// NewWorkerPool starts n workers running handler, key may be nil.
+func NewWorkerPool(n int, key KeyFunc, handler func([]byte)) *WorkerPool {
+	if n < 1 {
+		n = 1
+	}
+	p := &WorkerPool{
+		handler: handler,
+		key:     key,
+		keyed:   make([]chan []byte, n),
+		shared:  make(chan []byte, n),
+	}
+	for i := range p.keyed {
+		p.keyed[i] = make(chan []byte, 100)
+		p.wg.Add(1)
+		go p.work(p.keyed[i])
+	}
+	return p
+}
+
+// Handle queues a message for the workers, blocking if they are all busy.
+func (p *WorkerPool) Handle(line []byte) {
+	if p.key != nil {
+		if key := p.key(line); key != "" {
+			h := fnv.New32a()
+			h.Write([]byte(key))
+			p.keyed[h.Sum32()%uint32(len(p.keyed))] <- line
+			return
+		}
+	}
+	p.shared <- line
+}
+
+func (p *WorkerPool) work(keyed chan []byte) {
+	defer p.wg.Done()
+	shared := p.shared
+	for keyed != nil || shared != nil {
+		select {
+		case line, ok := <-keyed:
+			if !ok {
+				keyed = nil
+				continue
+			}
+			safeHandle(p.handler, line, p.ErrorHandler)
+		case line, ok := <-shared:
+			if !ok {
+				shared = nil
+				continue
+			}
+			safeHandle(p.handler, line, p.ErrorHandler)
+		}
+	}
+}
+
+// Close waits for the queued messages to be handled and stops the workers,
+// Handle must not be called after Close.
+func (p *WorkerPool) Close() {
+	p.once.Do(func() {
+		for _, ch := range p.keyed {
+			close(ch)
+		}
+		close(p.shared)
+		p.wg.Wait()
+	})
+}
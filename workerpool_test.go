@@ -0,0 +1,42 @@
+package httpstream
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestWorkerPool(t *testing.T) {
+	var mu sync.Mutex
+	byUser := make(map[string][]int)
+	pool := NewWorkerPool(4, UserIDKey, func(line []byte) {
+		var n int
+		fmt.Sscanf(jsonString(line, "id_str"), "%d", &n)
+		mu.Lock()
+		user := jsonString(line, "user", "id_str")
+		byUser[user] = append(byUser[user], n)
+		mu.Unlock()
+	})
+	for i := 0; i < 1000; i++ {
+		pool.Handle([]byte(fmt.Sprintf(`{"id_str":"%d","user":{"id_str":"%d"}}`, i, i%7)))
+	}
+	// no key, any worker
+	for i := 0; i < 100; i++ {
+		pool.Handle([]byte(`{"delete":{}}`))
+	}
+	pool.Close()
+
+	total := 0
+	for user, ids := range byUser {
+		total += len(ids)
+		for i := 1; i < len(ids); i++ {
+			if user != "" && ids[i] < ids[i-1] {
+				t.Errorf("user %s messages out of order %v", user, ids)
+				break
+			}
+		}
+	}
+	if total != 1100 {
+		t.Errorf("expected 1100 handled after Close got %d", total)
+	}
+}